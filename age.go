@@ -0,0 +1,338 @@
+package sev
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	PrefixAge = "age://"
+
+	envAgeIdentityFile = "SEV_AGE_IDENTITY_FILE"
+)
+
+// ageRef is a parsed "age://" reference to a file encrypted with age:
+//
+//	<path>[?identity=<path>][#<key>]
+//
+// The key selects a value of a YAML or JSON document like a Secrets Manager JSON key.
+// Without the identity query, the identity file is $SEV_AGE_IDENTITY_FILE.
+type ageRef struct {
+	path     string
+	identity string
+	key      string
+}
+
+func parseAgeRef(ref *Reference) (*ageRef, error) {
+	rest, key, _ := strings.Cut(ref.Path(), "#")
+	path, rawQuery, _ := strings.Cut(rest, "?")
+	query, err := url.ParseQuery(rawQuery)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query of '%s': %w", ref.Path(), err)
+	}
+
+	for name := range query {
+		if name != "identity" {
+			return nil, fmt.Errorf("unknown query parameter in '%s': '%s'", ref.Path(), name)
+		}
+	}
+
+	aref := &ageRef{key: key}
+	aref.path, err = localPath(ref, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if identity := query.Get("identity"); identity != "" {
+		aref.identity, err = localPath(ref, identity)
+	} else if identity := os.Getenv(envAgeIdentityFile); identity != "" {
+		aref.identity = expandHome(identity)
+	} else {
+		err = fmt.Errorf("age identity is not set: set ?identity= or %s: '%s'", envAgeIdentityFile, ref.Path())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return aref, nil
+}
+
+func decryptAge(path string, identityFile string) ([]byte, error) {
+	identityData, err := os.ReadFile(identityFile)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read age identity: %w", err)
+	}
+
+	identities, err := age.ParseIdentities(bytes.NewReader(identityData))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse age identity %s: %w", identityFile, err)
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var src io.Reader = bytes.NewReader(data)
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	}
+
+	r, err := age.Decrypt(src, identities...)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+
+	plaintext, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+
+	return plaintext, nil
+}
+
+// decodeYAML decodes a YAML or JSON document into the types of decodeJSON.
+// Scalars keep their source text, so that e.g. a timestamp or "1.5e10" is exported as written.
+func decodeYAML(data []byte) (any, error) {
+	var node yaml.Node
+	err := yaml.Unmarshal(data, &node)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return yamlNodeValue(&node)
+}
+
+func yamlNodeValue(n *yaml.Node) (any, error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		return yamlNodeValue(n.Content[0])
+	case yaml.AliasNode:
+		return yamlNodeValue(n.Alias)
+	case yaml.MappingNode:
+		return yamlMapping(n)
+	case yaml.SequenceNode:
+		list := []any{}
+
+		for _, item := range n.Content {
+			v, err := yamlNodeValue(item)
+
+			if err != nil {
+				return nil, err
+			}
+
+			list = append(list, v)
+		}
+
+		return list, nil
+	case yaml.ScalarNode:
+		return yamlScalar(n)
+	}
+
+	// An empty document.
+	return nil, nil
+}
+
+// yamlMapping decodes a mapping. Keys merged with "<<" are overridden by the keys of the mapping itself.
+func yamlMapping(n *yaml.Node) (map[string]any, error) {
+	obj := map[string]any{}
+	merged := map[string]any{}
+
+	for i := 0; i < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+
+		if key.ShortTag() == "!!merge" {
+			sources := []*yaml.Node{value}
+
+			if value.Kind == yaml.SequenceNode {
+				sources = value.Content
+			}
+
+			for _, src := range sources {
+				m, err := yamlNodeValue(src)
+
+				if err != nil {
+					return nil, err
+				}
+
+				mm, ok := m.(map[string]any)
+
+				if !ok {
+					return nil, fmt.Errorf("merge key in YAML mapping requires a mapping")
+				}
+
+				// Earlier mappings take precedence over later ones.
+				for k, v := range mm {
+					if _, ok := merged[k]; !ok {
+						merged[k] = v
+					}
+				}
+			}
+
+			continue
+		}
+
+		if key.Kind != yaml.ScalarNode || key.ShortTag() != "!!str" {
+			return nil, fmt.Errorf("non-string key in YAML mapping")
+		}
+
+		v, err := yamlNodeValue(value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		obj[key.Value] = v
+	}
+
+	for k, v := range merged {
+		if _, ok := obj[k]; !ok {
+			obj[k] = v
+		}
+	}
+
+	return obj, nil
+}
+
+func yamlScalar(n *yaml.Node) (any, error) {
+	switch n.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		err := n.Decode(&b)
+		return b, err
+	case "!!int", "!!float":
+		// Numbers that are not valid in JSON, e.g. "0x1F" or ".inf", are kept as strings.
+		if json.Valid([]byte(n.Value)) {
+			return json.Number(n.Value), nil
+		}
+	}
+
+	return n.Value, nil
+}
+
+// ageProvider resolves "age://" references. Without a key, the value is the whole plaintext.
+// A wildcard key spreads the top-level keys of a document.
+type ageProvider struct {
+	mu       sync.Mutex
+	decrypts map[string]*ageDecrypt
+}
+
+// ageDecrypt is shared by references to the same file so that it is decrypted once.
+type ageDecrypt struct {
+	once      sync.Once
+	plaintext []byte
+	err       error
+}
+
+func (p *ageProvider) Scheme() string {
+	return strings.TrimSuffix(PrefixAge, "://")
+}
+
+func (p *ageProvider) Resolve(_ context.Context, ref *Reference) (string, error) {
+	aref, plaintext, err := p.decrypt(ref)
+
+	if err != nil {
+		return "", err
+	}
+
+	if aref.key == "" {
+		return string(plaintext), nil
+	}
+
+	doc, err := decodeYAML(plaintext)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", aref.path, err)
+	}
+
+	return selectJSONKey(aref.path, doc, aref.key)
+}
+
+func (p *ageProvider) Expand(_ context.Context, ref *Reference) (map[string]string, error) {
+	aref, plaintext, err := p.decrypt(ref)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if aref.key != "" {
+		return nil, fmt.Errorf("wildcard key cannot select a key: '%s'", aref.key)
+	}
+
+	doc, err := decodeYAML(plaintext)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", aref.path, err)
+	}
+
+	obj, ok := doc.(map[string]any)
+
+	if !ok {
+		return nil, fmt.Errorf("wildcard key requires a mapping in '%s'", aref.path)
+	}
+
+	env := map[string]string{}
+
+	for key, value := range obj {
+		env[strings.Replace(ref.Name, "*", key, 1)], err = renderJSONValue(value)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return env, nil
+}
+
+func (p *ageProvider) decrypt(ref *Reference) (*ageRef, []byte, error) {
+	aref, err := parseAgeRef(ref)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	decryptKey := aref.path + "\x00" + aref.identity
+	p.mu.Lock()
+
+	if p.decrypts == nil {
+		p.decrypts = map[string]*ageDecrypt{}
+	}
+
+	d, ok := p.decrypts[decryptKey]
+
+	if !ok {
+		d = &ageDecrypt{}
+		p.decrypts[decryptKey] = d
+	}
+
+	p.mu.Unlock()
+
+	d.once.Do(func() {
+		d.plaintext, d.err = decryptAge(aref.path, aref.identity)
+	})
+
+	return aref, d.plaintext, d.err
+}
@@ -0,0 +1,164 @@
+package sev_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/winebarrel/sev"
+)
+
+func writeAgeFile(t *testing.T, path string, recipient age.Recipient, plaintext string, armored bool) {
+	buf := &bytes.Buffer{}
+	var dst io.Writer = buf
+	var armorWriter io.WriteCloser
+
+	if armored {
+		armorWriter = armor.NewWriter(buf)
+		dst = armorWriter
+	}
+
+	w, err := age.Encrypt(dst, recipient)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(plaintext))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	if armored {
+		require.NoError(t, armorWriter.Close())
+	}
+
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0600))
+}
+
+func newAgeIdentity(t *testing.T, path string) *age.X25519Identity {
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte("# created: test\n"+identity.String()+"\n"), 0600))
+	return identity
+}
+
+func Test_loadEnv_Age(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	identity := newAgeIdentity(t, filepath.Join(dir, "key.txt"))
+	writeAgeFile(t, filepath.Join(dir, "secrets.enc.yaml"), identity.Recipient(), "db:\n  user: admin\n  password: p@ss\n  port: 5432\napi_key: KEY1\n", false)
+	writeAgeFile(t, filepath.Join(dir, "secrets.enc.json"), identity.Recipient(), `{"token":"TOKEN","ratio":0.5}`, true)
+	writeAgeFile(t, filepath.Join(dir, "password.age"), identity.Recipient(), "raw\n", false)
+
+	envFrom := map[string]string{
+		"DB_USER":     "age://secrets.enc.yaml?identity=key.txt#db.user",
+		"DB_PASSWORD": "age://secrets.enc.yaml?identity=key.txt#db.password",
+		"DB_PORT":     "age://secrets.enc.yaml?identity=key.txt#db.port",
+		"TOKEN":       "age://" + filepath.Join(dir, "secrets.enc.json") + "#token",
+		"RAW":         "age://" + filepath.Join(dir, "password.age"),
+		"APP_*":       "age://secrets.enc.yaml?identity=key.txt",
+		"JSON_*":      "age://" + filepath.Join(dir, "secrets.enc.json"),
+	}
+
+	files := map[string]string{
+		"DB_USER":     filepath.Join(dir, ".sev.toml"),
+		"DB_PASSWORD": filepath.Join(dir, ".sev.toml"),
+		"DB_PORT":     filepath.Join(dir, ".sev.toml"),
+		"APP_*":       filepath.Join(dir, ".sev.toml"),
+	}
+
+	t.Setenv("SEV_AGE_IDENTITY_FILE", filepath.Join(dir, "key.txt"))
+	env, err := sev.LoadEnv(envFrom, files, sev.NewProviders(nil, nil), 4)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"DB_USER":     "admin",
+		"DB_PASSWORD": "p@ss",
+		"DB_PORT":     "5432",
+		"TOKEN":       "TOKEN",
+		"RAW":         "raw\n",
+		"APP_db":      `{"password":"p@ss","port":5432,"user":"admin"}`,
+		"APP_api_key": "KEY1",
+		"JSON_token":  "TOKEN",
+		"JSON_ratio":  "0.5",
+	}, env)
+}
+
+func Test_loadEnv_Age_Scalars(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	identity := newAgeIdentity(t, filepath.Join(dir, "key.txt"))
+	plaintext := `base: &base
+  host: localhost
+  port: 5432
+db:
+  <<: *base
+  port: 5433
+expires: 2024-01-01
+rate: 1.5e10
+mode: 0x1F
+enabled: true
+`
+	writeAgeFile(t, filepath.Join(dir, "secrets.enc.yaml"), identity.Recipient(), plaintext, false)
+
+	envFrom := map[string]string{
+		"EXPIRES": "age://secrets.enc.yaml?identity=key.txt#expires",
+		"DB":      "age://secrets.enc.yaml?identity=key.txt#db",
+		"APP_*":   "age://secrets.enc.yaml?identity=key.txt",
+	}
+
+	files := map[string]string{
+		"EXPIRES": filepath.Join(dir, ".sev.toml"),
+		"DB":      filepath.Join(dir, ".sev.toml"),
+		"APP_*":   filepath.Join(dir, ".sev.toml"),
+	}
+
+	env, err := sev.LoadEnv(envFrom, files, sev.NewProviders(nil, nil), 1)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"EXPIRES":     "2024-01-01",
+		"DB":          `{"host":"localhost","port":5433}`,
+		"APP_base":    `{"host":"localhost","port":5432}`,
+		"APP_db":      `{"host":"localhost","port":5433}`,
+		"APP_expires": "2024-01-01",
+		"APP_rate":    "1.5e10",
+		"APP_mode":    "0x1F",
+		"APP_enabled": "true",
+	}, env)
+}
+
+func Test_loadEnv_Age_Err(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secrets.age")
+	keyPath := filepath.Join(dir, "key.txt")
+	otherKeyPath := filepath.Join(dir, "other.txt")
+	identity := newAgeIdentity(t, keyPath)
+	newAgeIdentity(t, otherKeyPath)
+	writeAgeFile(t, path, identity.Recipient(), "foo: bar\n", false)
+
+	tt := []struct {
+		name     string
+		from     string
+		identity string
+		err      string
+	}{
+		{name: "FOO", from: "age://" + path + "#foo", err: "failed to get age://" + path + "#foo: age identity is not set: set ?identity= or SEV_AGE_IDENTITY_FILE: '" + path + "#foo'"},
+		{name: "FOO", from: "age://" + path + "?label=prod", identity: keyPath, err: "failed to get age://" + path + "?label=prod: unknown query parameter in '" + path + "?label=prod': 'label'"},
+		{name: "FOO", from: "age://" + path + "#foo", identity: otherKeyPath, err: "failed to get age://" + path + "#foo: failed to decrypt " + path + ": no identity matched any of the recipients"},
+		{name: "FOO", from: "age://" + path + "#bar", identity: keyPath, err: "failed to get age://" + path + "#bar: key could not be found in '" + path + "': 'bar'"},
+		{name: "FOO_*", from: "age://" + path + "#foo", identity: keyPath, err: "failed to get age://" + path + "#foo: wildcard key cannot select a key: 'foo'"},
+	}
+
+	for _, t1 := range tt {
+		t.Run(t1.from, func(t *testing.T) {
+			t.Setenv("SEV_AGE_IDENTITY_FILE", t1.identity)
+			_, err := sev.LoadEnv(map[string]string{t1.name: t1.from}, nil, sev.NewProviders(nil, nil), 4)
+			assert.EqualError(t, err, t1.err)
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package sev
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/processcreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+var (
+	_mfaTokenProvider = promptMFAToken
+	_ttyPath          = "/dev/tty"
+)
+
+// promptMFAToken asks for the MFA token code on the terminal, or on stderr and stdin without one.
+// stdout is left alone because it may be evaluated by a shell, e.g. eval "$(sev export prod)".
+func promptMFAToken() (string, error) {
+	var in io.Reader = _stdin
+	var out io.Writer = _stderr
+	tty, err := os.OpenFile(_ttyPath, os.O_RDWR, 0)
+
+	if err == nil {
+		defer tty.Close()
+		in = tty
+		out = tty
+	}
+
+	fmt.Fprint(out, "Assume Role MFA token code: ")
+	var code string
+	_, err = fmt.Fscanln(in, &code)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to read MFA token code: %w", err)
+	}
+
+	return code, nil
+}
+
+var awsSettingKeys = []string{
+	"region",
+	"role_arn",
+	"external_id",
+	"session_name",
+	"mfa_serial",
+	"endpoint_url",
+	"duration",
+	"credential_process",
+	"export_credentials",
+}
+
+// AWSSettings is the "_sev" table of a profile:
+//
+//	[prod._sev]
+//	region = "ap-northeast-1"
+//	role_arn = "arn:aws:iam::123456789012:role/sev" # or a list of roles to chain
+//	external_id = "..."
+//	session_name = "..."
+//	mfa_serial = "arn:aws:iam::123456789012:mfa/me"
+//	endpoint_url = "http://localhost:4566" # Secrets Manager and Parameter Store only
+//	duration = "1h"
+//	credential_process = "/usr/local/bin/get-credentials"
+//	export_credentials = true
+type AWSSettings struct {
+	Region            string
+	RoleARNs          []string
+	ExternalID        string
+	SessionName       string
+	MFASerial         string
+	EndpointURL       string
+	Duration          time.Duration
+	CredentialProcess string
+	ExportCredentials bool
+}
+
+func parseAWSSettings(settings map[string]any) (*AWSSettings, error) {
+	s := &AWSSettings{}
+
+	for key, value := range settings {
+		var err error
+
+		switch key {
+		case "region":
+			s.Region, err = settingString(key, value)
+		case "role_arn":
+			s.RoleARNs, err = settingStrings(key, value)
+		case "external_id":
+			s.ExternalID, err = settingString(key, value)
+		case "session_name":
+			s.SessionName, err = settingString(key, value)
+		case "mfa_serial":
+			s.MFASerial, err = settingString(key, value)
+		case "endpoint_url":
+			s.EndpointURL, err = settingString(key, value)
+		case "credential_process":
+			s.CredentialProcess, err = settingString(key, value)
+		case "duration":
+			var duration string
+			duration, err = settingString(key, value)
+
+			if err == nil {
+				s.Duration, err = time.ParseDuration(duration)
+
+				if err != nil {
+					err = fmt.Errorf("invalid duration in %s: %w", KeySettings, err)
+				}
+			}
+		case "export_credentials":
+			var ok bool
+			s.ExportCredentials, ok = value.(bool)
+
+			if !ok {
+				err = fmt.Errorf("value of %s in %s must be a boolean", key, KeySettings)
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(s.RoleARNs) == 0 && (s.ExternalID != "" || s.SessionName != "" || s.MFASerial != "" || s.Duration != 0) {
+		return nil, fmt.Errorf("external_id, session_name, mfa_serial and duration in %s require role_arn", KeySettings)
+	}
+
+	return s, nil
+}
+
+func settingString(key string, value any) (string, error) {
+	s, ok := value.(string)
+
+	if !ok {
+		return "", fmt.Errorf("value of %s in %s must be a string", key, KeySettings)
+	}
+
+	return s, nil
+}
+
+func settingStrings(key string, value any) ([]string, error) {
+	if s, ok := value.(string); ok {
+		return []string{s}, nil
+	}
+
+	values, ok := value.([]any)
+
+	if !ok || len(values) == 0 {
+		return nil, fmt.Errorf("value of %s in %s must be a string or a non-empty array of strings", key, KeySettings)
+	}
+
+	list := []string{}
+
+	for _, v := range values {
+		s, ok := v.(string)
+
+		if !ok {
+			return nil, fmt.Errorf("value of %s in %s must be a string or a non-empty array of strings", key, KeySettings)
+		}
+
+		list = append(list, s)
+	}
+
+	return list, nil
+}
+
+func (s *AWSSettings) loadOptions() AWSConfigOptFns {
+	optFns := AWSConfigOptFns{}
+
+	if s == nil {
+		return optFns
+	}
+
+	if s.Region != "" {
+		optFns = append(optFns, config.WithRegion(s.Region))
+	}
+
+	if s.CredentialProcess != "" {
+		optFns = append(optFns, config.WithCredentialsProvider(aws.NewCredentialsCache(processcreds.NewProvider(s.CredentialProcess))))
+	}
+
+	return optFns
+}
+
+// assumeRole replaces the credentials of cfg by assuming each role_arn in turn,
+// using the credentials of the previous hop as the source.
+// The MFA token is only needed for the first hop, which uses the original credentials.
+func (s *AWSSettings) assumeRole(cfg *aws.Config) {
+	if s == nil {
+		return
+	}
+
+	for i, roleARN := range s.RoleARNs {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(*cfg), roleARN, func(o *stscreds.AssumeRoleOptions) {
+			if s.ExternalID != "" {
+				o.ExternalID = aws.String(s.ExternalID)
+			}
+
+			if s.SessionName != "" {
+				o.RoleSessionName = s.SessionName
+			}
+
+			if s.Duration != 0 {
+				o.Duration = s.Duration
+			}
+
+			if i == 0 && s.MFASerial != "" {
+				o.SerialNumber = aws.String(s.MFASerial)
+				o.TokenProvider = _mfaTokenProvider
+			}
+		})
+
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+}
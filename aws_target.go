@@ -0,0 +1,60 @@
+package sev
+
+import (
+	"cmp"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// AWSTarget is the region and AWS profile that a reference is fetched with,
+// set by its "region" and "aws_profile" query parameters or by the region of an ARN.
+// The zero value uses the defaults of the sev profile.
+type AWSTarget struct {
+	Region  string
+	Profile string
+}
+
+func (t *AWSTarget) setQuery(name string, value string) bool {
+	switch name {
+	case "region":
+		t.Region = value
+	case "aws_profile":
+		t.Profile = value
+	default:
+		return false
+	}
+
+	return true
+}
+
+func (t AWSTarget) encode(query url.Values) {
+	if t.Region != "" {
+		query.Set("region", t.Region)
+	}
+
+	if t.Profile != "" {
+		query.Set("aws_profile", t.Profile)
+	}
+}
+
+// regionFromARN returns the region field of an ARN, e.g. "ap-northeast-1" of
+// "arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:foo".
+func regionFromARN(arn string) string {
+	parts := strings.SplitN(arn, ":", 5)
+
+	if len(parts) < 5 || parts[0] != "arn" {
+		return ""
+	}
+
+	return parts[3]
+}
+
+// sortedTargets returns the targets that batched references are grouped by, in a stable order.
+// References are grouped by target because a batch API call reads from a single region and account.
+func sortedTargets[T any](m map[AWSTarget]T) []AWSTarget {
+	return slices.SortedFunc(maps.Keys(m), func(a AWSTarget, b AWSTarget) int {
+		return cmp.Or(cmp.Compare(a.Region, b.Region), cmp.Compare(a.Profile, b.Profile))
+	})
+}
@@ -0,0 +1,150 @@
+package sev
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	PrefixCmd = "cmd://"
+
+	DefaultCmdTimeout = 30 * time.Second
+)
+
+// cmdProvider resolves "cmd://" references to the stdout of a command, without trailing newlines:
+//
+//	<command> [<arg>...]
+//
+// Arguments are split on spaces and may be quoted, but are not expanded by a shell.
+// Only commands in the allowlist can run, so that a config file cannot run arbitrary programs.
+type cmdProvider struct {
+	allow   []string
+	timeout time.Duration
+}
+
+func (p *cmdProvider) Scheme() string {
+	return strings.TrimSuffix(PrefixCmd, "://")
+}
+
+func (p *cmdProvider) Resolve(ctx context.Context, ref *Reference) (string, error) {
+	args, err := p.parse(ref)
+
+	if err != nil {
+		return "", err
+	}
+
+	timeout := p.timeout
+
+	if timeout <= 0 {
+		timeout = DefaultCmdTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Do not wait for children that keep stdout open after the command is killed.
+	cmd.WaitDelay = time.Second
+	err = cmd.Run()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("command timed out after %s: %s", timeout, args[0])
+	}
+
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("command failed: %s: %w: %s", args[0], err, msg)
+		}
+
+		return "", fmt.Errorf("command failed: %s: %w", args[0], err)
+	}
+
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+func (p *cmdProvider) parse(ref *Reference) ([]string, error) {
+	args, err := splitCommandLine(ref.Path())
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse command '%s': %w", ref.Path(), err)
+	}
+
+	if len(args) == 0 {
+		return nil, fmt.Errorf("command is empty: '%s'", ref.URI)
+	}
+
+	if !slices.Contains(p.allow, args[0]) {
+		return nil, fmt.Errorf("command is not allowed: %s: add it to --allow-cmd or SEV_ALLOW_CMD", args[0])
+	}
+
+	return args, nil
+}
+
+// splitCommandLine splits s on spaces. Single quotes keep their content as is,
+// and a backslash escapes the next character outside them.
+func splitCommandLine(s string) ([]string, error) {
+	args := []string{}
+	arg := &strings.Builder{}
+	inArg := false
+	var quote byte
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				arg.WriteByte(c)
+			}
+		case c == '\\':
+			i++
+
+			if i == len(s) {
+				return nil, fmt.Errorf("trailing backslash")
+			}
+
+			arg.WriteByte(s[i])
+			inArg = true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				arg.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unclosed quote")
+	}
+
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/alecthomas/kong"
 	"github.com/winebarrel/sev"
@@ -14,25 +17,103 @@ func init() {
 	log.SetFlags(0)
 }
 
-func parseArgs() *sev.Options {
-	var CLI struct {
-		sev.Options
-		Version kong.VersionFlag
-	}
+type CLI struct {
+	Run     sev.Options       `cmd:"" default:"withargs" help:"Run a command with the profile's environment variables (default)."`
+	Export  sev.ExportOptions `cmd:"" help:"Print the profile's environment variables as shell-evaluable assignments."`
+	Version kong.VersionFlag
+}
 
-	parser := kong.Must(&CLI, kong.Vars{"version": version})
+func parseArgs() (*CLI, string) {
+	var cli CLI
+	parser := kong.Must(&cli, kong.Vars{"version": version})
 	parser.Model.HelpFlag.Help = "Show help."
-	_, err := parser.Parse(os.Args[1:])
+	args, err := normalizeArgs(parser, os.Args[1:])
 	parser.FatalIfErrorf(err)
+	ctx, err := parser.Parse(args)
+	parser.FatalIfErrorf(err)
+
+	return &cli, ctx.Command()
+}
+
+// normalizeArgs keeps "sev [flags] <profile> -- <command>" working for profiles named like a subcommand:
+// a subcommand name followed by "--" is a profile of the default run command.
+// Flags before a subcommand are rejected, since they would not apply to it.
+func normalizeArgs(parser *kong.Kong, args []string) ([]string, error) {
+	valueFlags := map[string]bool{}
+
+	for _, cmd := range parser.Model.Children {
+		for _, flags := range cmd.AllFlags(false) {
+			for _, flag := range flags {
+				if !flag.IsBool() {
+					valueFlags["--"+flag.Name] = true
+
+					if flag.Short != 0 {
+						valueFlags["-"+string(flag.Short)] = true
+					}
+				}
+			}
+		}
+	}
+
+	flagsBefore := []string{}
+	i := 0
+
+	for i < len(args) && strings.HasPrefix(args[i], "-") && args[i] != "--" {
+		flag, _, hasValue := strings.Cut(args[i], "=")
+
+		if flag != "-h" && flag != "--help" && flag != "--version" {
+			flagsBefore = append(flagsBefore, flag)
+		}
+
+		if valueFlags[flag] && !hasValue {
+			i++
+		}
+
+		i++
+	}
 
-	return &CLI.Options
+	if i >= len(args) {
+		return args, nil
+	}
+
+	var isCommand bool
+
+	for _, cmd := range parser.Model.Children {
+		isCommand = isCommand || cmd.Name == args[i]
+	}
+
+	if !isCommand {
+		return args, nil
+	}
+
+	if i+1 < len(args) && args[i+1] == "--" {
+		return append([]string{"run"}, args...), nil
+	}
+
+	if len(flagsBefore) > 0 {
+		return nil, fmt.Errorf("flags must follow the %s command: %s", args[i], strings.Join(flagsBefore, ", "))
+	}
+
+	return args, nil
 }
 
 func main() {
-	options := parseArgs()
-	err := sev.Run(options)
+	cli, command := parseArgs()
+	var err error
+
+	if strings.HasPrefix(command, "export ") {
+		err = sev.Export(&cli.Export)
+	} else {
+		err = sev.Run(&cli.Run)
+	}
 
 	if err != nil {
+		var exitErr *sev.ExitError
+
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
+
 		log.Fatalf("sev error: %s", err)
 	}
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_normalizeArgs(t *testing.T) {
+	parser := kong.Must(&CLI{})
+
+	tt := []struct {
+		args     string
+		expected string
+	}{
+		{args: "prod -- env", expected: "prod -- env"},
+		{args: "--config-glob c.toml prod -- env", expected: "--config-glob c.toml prod -- env"},
+		{args: "run --config-glob c.toml prod -- env", expected: "run --config-glob c.toml prod -- env"},
+		{args: "export --config-glob c.toml prod", expected: "export --config-glob c.toml prod"},
+		{args: "export -- env", expected: "run export -- env"},
+		{args: "--config-glob c.toml export -- env", expected: "run --config-glob c.toml export -- env"},
+		{args: "--no-exec run -- env", expected: "run --no-exec run -- env"},
+		{args: "--help export", expected: "--help export"},
+	}
+
+	for _, t1 := range tt {
+		t.Run(t1.args, func(t *testing.T) {
+			args, err := normalizeArgs(parser, strings.Fields(t1.args))
+			assert.NoError(t, err)
+			assert.Equal(t, strings.Fields(t1.expected), args)
+		})
+	}
+}
+
+func Test_normalizeArgs_Err(t *testing.T) {
+	parser := kong.Must(&CLI{})
+
+	tt := []struct {
+		args string
+		err  string
+	}{
+		{args: "--config-glob c.toml export prod", err: "flags must follow the export command: --config-glob"},
+		{args: "--concurrency=2 --no-exec run prod env", err: "flags must follow the run command: --concurrency, --no-exec"},
+	}
+
+	for _, t1 := range tt {
+		t.Run(t1.args, func(t *testing.T) {
+			_, err := normalizeArgs(parser, strings.Fields(t1.args))
+			assert.EqualError(t, err, t1.err)
+		})
+	}
+}
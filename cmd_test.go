@@ -0,0 +1,64 @@
+package sev_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/winebarrel/sev"
+)
+
+func Test_splitCommandLine(t *testing.T) {
+	tt := []struct {
+		line string
+		args []string
+	}{
+		{line: "op read op://vault/item/password", args: []string{"op", "read", "op://vault/item/password"}},
+		{line: "  pass   show  db ", args: []string{"pass", "show", "db"}},
+		{line: `tool "a b" 'c "d"' e\ f ""`, args: []string{"tool", "a b", `c "d"`, "e f", ""}},
+		{line: `tool '\n' "\""`, args: []string{"tool", `\n`, `"`}},
+		{line: "", args: []string{}},
+	}
+
+	for _, t1 := range tt {
+		t.Run(t1.line, func(t *testing.T) {
+			args, err := sev.SplitCommandLine(t1.line)
+			assert.NoError(t, err)
+			assert.Equal(t, t1.args, args)
+		})
+	}
+}
+
+func Test_splitCommandLine_Err(t *testing.T) {
+	tt := []struct {
+		line string
+		err  string
+	}{
+		{line: `tool "a`, err: "unclosed quote"},
+		{line: `tool 'a`, err: "unclosed quote"},
+		{line: `tool a\`, err: "trailing backslash"},
+	}
+
+	for _, t1 := range tt {
+		t.Run(t1.line, func(t *testing.T) {
+			_, err := sev.SplitCommandLine(t1.line)
+			assert.EqualError(t, err, t1.err)
+		})
+	}
+}
+
+func Test_loadEnv_Cmd_NotAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	envFrom := map[string]string{
+		"FOO": "cmd://op read op://vault/item/password",
+	}
+
+	_, err := sev.LoadEnv(envFrom, nil, &mockProviders{}, 1)
+	assert.EqualError(err, "failed to get cmd://op read op://vault/item/password: command is not allowed: op: add it to --allow-cmd or SEV_ALLOW_CMD")
+
+	_, err = sev.LoadEnvWith(envFrom, nil, sev.NewCmdProvider([]string{"pass"}, 0))
+	assert.EqualError(err, "failed to get cmd://op read op://vault/item/password: command is not allowed: op: add it to --allow-cmd or SEV_ALLOW_CMD")
+
+	_, err = sev.LoadEnvWith(map[string]string{"FOO": "cmd://"}, nil, sev.NewCmdProvider([]string{"op"}, 0))
+	assert.EqualError(err, "failed to get cmd://: command is empty: 'cmd://'")
+}
@@ -0,0 +1,98 @@
+//go:build unix
+
+package sev_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/winebarrel/sev"
+)
+
+func writeScript(t *testing.T, dir string, name string, body string) string {
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0700)
+	require.NoError(t, err)
+	return path
+}
+
+func Test_loadEnv_Cmd(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	secret := writeScript(t, dir, "secret", `echo "$1:$2"`+"\n")
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	envFrom := map[string]string{
+		"FOO":  "cmd://secret read 'db password'",
+		"BAR":  "cmd://" + secret + " show api",
+		"ZOO":  "zoo",
+		"HOGE": "cmd://secret",
+	}
+
+	env, err := sev.LoadEnvWith(envFrom, nil, sev.NewCmdProvider([]string{"secret", secret}, time.Second))
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"FOO":  "read:db password",
+		"BAR":  "show:api",
+		"ZOO":  "zoo",
+		"HOGE": ":",
+	}, env)
+}
+
+func Test_loadEnv_Cmd_Err(t *testing.T) {
+	dir := t.TempDir()
+	fail := writeScript(t, dir, "fail", "echo 'item not found' >&2\nexit 3\n")
+	silent := writeScript(t, dir, "silent", "exit 1\n")
+	slow := writeScript(t, dir, "slow", "sleep 10\n")
+	missing := filepath.Join(dir, "missing")
+	cmd := sev.NewCmdProvider([]string{fail, silent, slow, missing}, 100*time.Millisecond)
+
+	tt := []struct {
+		name string
+		from string
+		err  string
+	}{
+		{name: "FOO", from: "cmd://" + fail, err: "failed to get cmd://" + fail + ": command failed: " + fail + ": exit status 3: item not found"},
+		{name: "FOO", from: "cmd://" + silent, err: "failed to get cmd://" + silent + ": command failed: " + silent + ": exit status 1"},
+		{name: "FOO", from: "cmd://" + slow, err: "failed to get cmd://" + slow + ": command timed out after 100ms: " + slow},
+		{name: "FOO", from: "cmd://" + missing, err: "failed to get cmd://" + missing + ": command failed: " + missing + ": fork/exec " + missing + ": no such file or directory"},
+		{name: "FOO_*", from: "cmd://" + fail, err: "failed to get cmd://" + fail + ": wildcard key is not supported by cmd://"},
+	}
+
+	for _, t1 := range tt {
+		t.Run(t1.from, func(t *testing.T) {
+			_, err := sev.LoadEnvWith(map[string]string{t1.name: t1.from}, nil, cmd)
+			assert.EqualError(t, err, t1.err)
+		})
+	}
+}
+
+func Test_dryRun_Cmd(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	called := filepath.Join(dir, "called")
+	secret := writeScript(t, dir, "secret", "touch "+called+"\necho SECRET\n")
+	missing := filepath.Join(dir, "missing")
+	cmd := sev.NewCmdProvider([]string{secret, missing}, time.Second)
+
+	out, err := sev.DryRunWith(map[string]string{"FOO": "cmd://" + secret}, false, cmd)
+	assert.NoError(err)
+	assert.Contains(out, "FOO   -     cmd://"+secret+"  ********  ok")
+	assert.NoFileExists(called)
+
+	out, err = sev.DryRunWith(map[string]string{"FOO": "cmd://" + secret}, true, cmd)
+	assert.NoError(err)
+	assert.Contains(out, `"SECRET"`)
+	assert.FileExists(called)
+
+	out, err = sev.DryRunWith(map[string]string{"FOO": "cmd://" + missing}, false, cmd)
+	assert.EqualError(err, "dry run found 1 unreachable variable(s)")
+	assert.Contains(out, "error: exec: \""+missing+"\": stat "+missing+": no such file or directory")
+}
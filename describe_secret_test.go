@@ -0,0 +1,70 @@
+package sev_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/winebarrel/sev"
+)
+
+type mockDescribeSecretAPI func(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error)
+
+func (m mockDescribeSecretAPI) DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+func Test_describeSecret_OK(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := mockDescribeSecretAPI(func(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+		assert.Equal("foo/bar/zoo", aws.ToString(params.SecretId))
+
+		outout := &secretsmanager.DescribeSecretOutput{
+			VersionIdsToStages: map[string][]string{
+				"v1": {"AWSPREVIOUS"},
+				"v2": {"AWSCURRENT"},
+			},
+		}
+
+		return outout, nil
+	})
+
+	assert.NoError(sev.DescribeSecret(svc, "foo/bar/zoo"))
+	assert.NoError(sev.DescribeSecret(svc, "foo/bar/zoo?stage=AWSPREVIOUS"))
+	assert.NoError(sev.DescribeSecret(svc, "foo/bar/zoo?version_id=v2"))
+	assert.NoError(sev.DescribeSecret(svc, "foo/bar/zoo?stage=AWSCURRENT&version_id=v2"))
+}
+
+func Test_describeSecret_Err_VersionNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := mockDescribeSecretAPI(func(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+		outout := &secretsmanager.DescribeSecretOutput{
+			VersionIdsToStages: map[string][]string{
+				"v2": {"AWSCURRENT"},
+			},
+		}
+
+		return outout, nil
+	})
+
+	assert.EqualError(sev.DescribeSecret(svc, "foo/bar/zoo?stage=AWSPENDING"), "stage could not be found in 'foo/bar/zoo': 'AWSPENDING'")
+	assert.EqualError(sev.DescribeSecret(svc, "foo/bar/zoo?version_id=v1"), "version could not be found in 'foo/bar/zoo': 'v1'")
+	assert.EqualError(sev.DescribeSecret(svc, "foo/bar/zoo?stage=AWSPREVIOUS&version_id=v2"), "stage could not be found in 'foo/bar/zoo': 'AWSPREVIOUS'")
+}
+
+func Test_describeSecret_Err(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := mockDescribeSecretAPI(func(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+		return nil, errors.New("unexpected error")
+	})
+
+	err := sev.DescribeSecret(svc, "foo/bar/zoo")
+
+	assert.ErrorContains(err, "unexpected error")
+}
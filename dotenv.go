@@ -0,0 +1,118 @@
+package sev
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseDotenv reads KEY=VALUE lines, as written by "sev export --format dotenv".
+// An "export " prefix and "#" comments are allowed. Double-quoted values may contain escapes
+// and span lines, single-quoted values are taken literally, and unquoted values are trimmed.
+func parseDotenv(data string) (map[string]string, error) {
+	env := map[string]string{}
+	rest := strings.ReplaceAll(data, "\r\n", "\n")
+	lineNum := 0
+
+	for rest != "" {
+		var line string
+		line, rest, _ = strings.Cut(rest, "\n")
+		lineNum++
+		line = strings.TrimSpace(line)
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+
+		if !ok || !reShellName.MatchString(name) {
+			return nil, fmt.Errorf("invalid line %d in dotenv", lineNum)
+		}
+
+		value = strings.TrimLeft(value, " \t")
+
+		switch {
+		case strings.HasPrefix(value, `"`):
+			// A double-quoted value may continue on the following lines.
+			for !hasClosingQuote(value) && rest != "" {
+				var next string
+				next, rest, _ = strings.Cut(rest, "\n")
+				lineNum++
+				value += "\n" + next
+			}
+
+			unquoted, err := unquoteDotenv(value)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid value of %s at line %d in dotenv: %w", name, lineNum, err)
+			}
+
+			env[name] = unquoted
+		case strings.HasPrefix(value, "'"):
+			end := strings.Index(value[1:], "'")
+
+			if end < 0 {
+				return nil, fmt.Errorf("invalid value of %s at line %d in dotenv: unclosed quote", name, lineNum)
+			}
+
+			env[name] = value[1 : end+1]
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = value[:i]
+			}
+
+			env[name] = strings.TrimSpace(value)
+		}
+	}
+
+	return env, nil
+}
+
+func hasClosingQuote(value string) bool {
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			return true
+		}
+	}
+
+	return false
+}
+
+func unquoteDotenv(value string) (string, error) {
+	out := &strings.Builder{}
+
+	for i := 1; i < len(value); i++ {
+		c := value[i]
+
+		switch c {
+		case '"':
+			return out.String(), nil
+		case '\\':
+			i++
+
+			if i == len(value) {
+				return "", fmt.Errorf("unclosed quote")
+			}
+
+			switch value[i] {
+			case 'n':
+				out.WriteByte('\n')
+			case 'r':
+				out.WriteByte('\r')
+			case 't':
+				out.WriteByte('\t')
+			default:
+				out.WriteByte(value[i])
+			}
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	return "", fmt.Errorf("unclosed quote")
+}
@@ -0,0 +1,318 @@
+package sev
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const maskedValue = "********"
+
+type dryRunEntry struct {
+	name   string
+	file   string
+	source string
+	value  string
+	err    error
+}
+
+func dryRun(envFrom map[string]string, files map[string]string, reg *registry, reveal bool) error {
+	entries := checkEnv(envFrom, files, reg, reveal)
+	w := tabwriter.NewWriter(_stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tFILE\tSOURCE\tVALUE\tSTATUS")
+	failed := 0
+
+	for _, e := range entries {
+		status := "ok"
+
+		if e.err != nil {
+			status = "error: " + e.err.Error()
+			failed++
+		}
+
+		file := e.file
+
+		if file == "" {
+			file = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.name, file, e.source, e.value, status)
+	}
+
+	err := w.Flush()
+
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("dry run found %d unreachable variable(s)", failed)
+	}
+
+	return nil
+}
+
+// checkEnv describes where each variable comes from and checks that the source is reachable.
+// Secrets are checked with DescribeSecret unless reveal is set or a wildcard key has to be expanded.
+// Providers without their own check are resolved, and their values are masked unless reveal is set.
+func checkEnv(envFrom map[string]string, files map[string]string, reg *registry, reveal bool) []*dryRunEntry {
+	c := &envChecker{envFrom: envFrom, reveal: reveal}
+	entries := []*dryRunEntry{}
+
+	for _, name := range slices.Sorted(maps.Keys(envFrom)) {
+		ref := &Reference{Name: name, URI: envFrom[name], File: files[name]}
+		n := len(entries)
+
+		if p, ok := reg.lookup(ref.URI); ok {
+			if pc, ok := p.(providerChecker); ok {
+				entries = append(entries, pc.check(c, ref)...)
+			} else {
+				entries = append(entries, c.checkProvider(p, ref)...)
+			}
+		} else if ref.Wildcard() {
+			entries = append(entries, &dryRunEntry{name: name, source: "literal", value: "-", err: reg.errWildcardLiteral(name)})
+		} else {
+			entries = append(entries, &dryRunEntry{name: name, source: "literal", value: c.display(ref.URI)})
+		}
+
+		for _, e := range entries[n:] {
+			e.file = ref.File
+		}
+	}
+
+	return entries
+}
+
+// providerChecker is implemented by built-in providers that check a reference without reading its value.
+type providerChecker interface {
+	check(c *envChecker, ref *Reference) []*dryRunEntry
+}
+
+type envChecker struct {
+	envFrom map[string]string
+	reveal  bool
+}
+
+func (c *envChecker) display(value string) string {
+	if c.reveal {
+		return strconv.Quote(value)
+	}
+
+	return maskedValue
+}
+
+func (p *secretsManagerProvider) check(c *envChecker, r *Reference) []*dryRunEntry {
+	name := r.Name
+	wildcard := r.Wildcard()
+	entry := &dryRunEntry{name: name, source: r.URI, value: "-"}
+	ref, err := parseSecretRef(r.Path())
+
+	if err == nil {
+		err = ref.validate(wildcard)
+	}
+
+	if err != nil {
+		entry.err = err
+		return []*dryRunEntry{entry}
+	}
+
+	entry.source = ref.source("")
+	svc, err := p.clients.NewSecretsManagerClient(ref.target)
+
+	if err != nil {
+		entry.err = err
+		return []*dryRunEntry{entry}
+	}
+
+	// A wildcard key reads the secret to list the variables it spreads to; their values are still masked.
+	if !c.reveal && !wildcard {
+		entry.err = describeSecret(svc, ref.versionedID())
+
+		if entry.err == nil {
+			entry.value = maskedValue
+		}
+
+		return []*dryRunEntry{entry}
+	}
+
+	value, err := getSecretValue(context.Background(), svc, ref.versionedID())
+
+	if err != nil {
+		entry.err = err
+		return []*dryRunEntry{entry}
+	}
+
+	// Never write temp files in a dry run.
+	ref.binaryFile = false
+
+	if !wildcard {
+		resolved, err := ref.resolve(value)
+
+		if err != nil {
+			entry.err = err
+		} else {
+			entry.value = c.display(resolved)
+		}
+
+		return []*dryRunEntry{entry}
+	}
+
+	values, err := ref.spread(value)
+
+	if err != nil {
+		entry.err = err
+		return []*dryRunEntry{entry}
+	}
+
+	return c.expand(entry, values, func(key string) (string, string) {
+		return strings.Replace(name, "*", key, 1), ref.source(key)
+	})
+}
+
+func (p *parameterStoreProvider) check(c *envChecker, r *Reference) []*dryRunEntry {
+	if r.Wildcard() {
+		return p.checkPath(c, r)
+	}
+
+	return []*dryRunEntry{p.checkName(c, r)}
+}
+
+func (p *parameterStoreProvider) checkName(c *envChecker, r *Reference) *dryRunEntry {
+	entry := &dryRunEntry{name: r.Name, source: r.URI, value: "-"}
+	ref, err := parseParameterRef(r.Path())
+
+	if err != nil {
+		entry.err = err
+		return entry
+	}
+
+	entry.source = "parameterstore name=" + ref.key()
+	svc, err := p.clients.NewSSMClient(ref.target)
+
+	if err != nil {
+		entry.err = err
+		return entry
+	}
+
+	if !c.reveal {
+		entry.err = checkParameter(svc, ref.name)
+
+		if entry.err == nil {
+			entry.value = maskedValue
+		}
+
+		return entry
+	}
+
+	value, err := getParameter(svc, ref.name)
+
+	if err != nil {
+		entry.err = err
+		return entry
+	}
+
+	entry.value = c.display(value)
+	return entry
+}
+
+func (p *parameterStoreProvider) checkPath(c *envChecker, r *Reference) []*dryRunEntry {
+	name := r.Name
+	entry := &dryRunEntry{name: name, source: r.URI, value: "-"}
+	ref, err := parseParameterPathRef(r.Path())
+
+	if err != nil {
+		entry.err = err
+		return []*dryRunEntry{entry}
+	}
+
+	entry.source = "parameterstore path=" + ref.key()
+	svc, err := p.clients.NewSSMClient(ref.target)
+
+	if err != nil {
+		entry.err = err
+		return []*dryRunEntry{entry}
+	}
+
+	values, err := getParametersByPath(context.Background(), svc, ref.path, ref.recursive)
+
+	if err != nil {
+		entry.err = err
+		return []*dryRunEntry{entry}
+	}
+
+	return c.expand(entry, values, func(paramName string) (string, string) {
+		return ref.envName(name, paramName), "parameterstore name=" + paramName
+	})
+}
+
+// check does not run the command unless reveal is set.
+func (p *cmdProvider) check(c *envChecker, r *Reference) []*dryRunEntry {
+	entry := &dryRunEntry{name: r.Name, source: r.URI, value: "-"}
+	args, err := p.parse(r)
+
+	if err == nil {
+		_, err = exec.LookPath(args[0])
+	}
+
+	if err != nil {
+		entry.err = err
+		return []*dryRunEntry{entry}
+	}
+
+	if c.reveal {
+		return c.checkProvider(p, r)
+	}
+
+	entry.value = maskedValue
+	return []*dryRunEntry{entry}
+}
+
+func (p *literalProvider) check(c *envChecker, r *Reference) []*dryRunEntry {
+	return []*dryRunEntry{{name: r.Name, source: "literal", value: c.display(r.Path())}}
+}
+
+// checkProvider resolves ref, since a provider without its own check cannot test reachability otherwise.
+func (c *envChecker) checkProvider(p Provider, ref *Reference) []*dryRunEntry {
+	entry := &dryRunEntry{name: ref.Name, source: ref.URI, value: "-"}
+	result := resolveOne(context.Background(), p, ref)
+
+	if result.Err != nil {
+		entry.err = result.Err
+		return []*dryRunEntry{entry}
+	}
+
+	if !ref.Wildcard() {
+		entry.value = c.display(result.Value)
+		return []*dryRunEntry{entry}
+	}
+
+	return c.expand(entry, result.Env, func(envName string) (string, string) {
+		return envName, ref.URI
+	})
+}
+
+// expand lists the variables a wildcard key expands to, or the wildcard key itself if there are none.
+func (c *envChecker) expand(entry *dryRunEntry, values map[string]string, envNameOf func(string) (string, string)) []*dryRunEntry {
+	entries := []*dryRunEntry{}
+
+	for _, origin := range slices.Sorted(maps.Keys(values)) {
+		envName, source := envNameOf(origin)
+
+		if _, ok := c.envFrom[envName]; ok {
+			continue
+		}
+
+		entries = append(entries, &dryRunEntry{name: envName, source: source, value: c.display(values[origin])})
+	}
+
+	if len(entries) == 0 {
+		return []*dryRunEntry{entry}
+	}
+
+	return entries
+}
@@ -0,0 +1,152 @@
+package sev_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/winebarrel/sev"
+)
+
+func newDryRunProviders(t *testing.T) *mockProviders {
+	require := require.New(t)
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	t.Cleanup(httpmock.DeactivateAndReset)
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+
+		switch req.Header.Get("X-Amz-Target") + " " + string(body) {
+		case `secretsmanager.DescribeSecret {"SecretId":"foo/bar"}`, `secretsmanager.DescribeSecret {"SecretId":"foo/zoo"}`:
+			return httpmock.NewStringResponse(http.StatusOK, `{"VersionIdsToStages":{"v1":["AWSCURRENT"]}}`), nil
+		case `secretsmanager.GetSecretValue {"SecretId":"foo/bar"}`:
+			return httpmock.NewStringResponse(http.StatusOK, `{"SecretString":"BAZ"}`), nil
+		case `secretsmanager.GetSecretValue {"SecretId":"foo/zoo"}`:
+			return httpmock.NewStringResponse(http.StatusOK, `{"SecretString":"{\"TOKEN\":\"AAA\",\"SECRET\":\"BBB\"}"}`), nil
+		default:
+			return httpmock.NewStringResponse(http.StatusBadRequest, `{"__type":"ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`), nil
+		}
+	})
+
+	httpmock.RegisterResponder(http.MethodPost, "https://ssm.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+
+		switch req.Header.Get("X-Amz-Target") + " " + string(body) {
+		case `AmazonSSM.GetParameter {"Name":"/hoge/fuga","WithDecryption":false}`:
+			return httpmock.NewStringResponse(http.StatusOK, `{"Parameter":{"Name":"/hoge/fuga","Value":"ENCRYPTED"}}`), nil
+		case `AmazonSSM.GetParameter {"Name":"/hoge/fuga","WithDecryption":true}`:
+			return httpmock.NewStringResponse(http.StatusOK, `{"Parameter":{"Name":"/hoge/fuga","Value":"FUGA"}}`), nil
+		case `AmazonSSM.GetParametersByPath {"Path":"/app","Recursive":false,"WithDecryption":true}`:
+			return httpmock.NewStringResponse(http.StatusOK, `{"Parameters":[{"Name":"/app/db-host","Value":"localhost"}]}`), nil
+		default:
+			return httpmock.NewStringResponse(http.StatusBadRequest, `{"__type":"ParameterNotFound","message":""}`), nil
+		}
+	})
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	return &mockProviders{
+		newSecretsManagerClient: func() (*secretsmanager.Client, error) {
+			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+			require.NoError(err)
+			svc := secretsmanager.NewFromConfig(cfg)
+			return svc, nil
+		},
+		newSSMClient: func() (*ssm.Client, error) {
+			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+			require.NoError(err)
+			svc := ssm.NewFromConfig(cfg)
+			return svc, nil
+		},
+	}
+}
+
+func Test_dryRun_OK(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	providers := newDryRunProviders(t)
+
+	envFrom := map[string]string{
+		"FOO":   "secretsmanager://foo/bar",
+		"ZOO":   "secretsmanager://foo/zoo:TOKEN",
+		"ZOO_*": "secretsmanager://foo/zoo",
+		"HOGE":  "parameterstore://hoge/fuga",
+		"APP_*": "parameterstore:///app",
+		"HELLO": "world",
+	}
+
+	files := map[string]string{
+		"FOO":   "a.toml",
+		"ZOO":   "a.toml",
+		"ZOO_*": "a.toml",
+		"HOGE":  "b.toml",
+		"APP_*": "b.toml",
+		"HELLO": "b.toml",
+	}
+
+	out, err := sev.DryRun(envFrom, files, providers, false)
+	require.NoError(err)
+	assert.Equal(`NAME         FILE    SOURCE                                VALUE     STATUS
+APP_DB_HOST  b.toml  parameterstore name=/app/db-host      ********  ok
+FOO          a.toml  secretsmanager id=foo/bar             ********  ok
+HELLO        b.toml  literal                               ********  ok
+HOGE         b.toml  parameterstore name=/hoge/fuga        ********  ok
+ZOO          a.toml  secretsmanager id=foo/zoo key=TOKEN   ********  ok
+ZOO_SECRET   a.toml  secretsmanager id=foo/zoo key=SECRET  ********  ok
+ZOO_TOKEN    a.toml  secretsmanager id=foo/zoo key=TOKEN   ********  ok
+`, out)
+}
+
+func Test_dryRun_OK_Reveal(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	providers := newDryRunProviders(t)
+
+	envFrom := map[string]string{
+		"FOO":   "secretsmanager://foo/bar",
+		"ZOO":   "secretsmanager://foo/zoo:TOKEN",
+		"ZOO_*": "secretsmanager://foo/zoo",
+		"HOGE":  "parameterstore://hoge/fuga",
+		"HELLO": "world",
+	}
+
+	out, err := sev.DryRun(envFrom, nil, providers, true)
+	require.NoError(err)
+	assert.Equal(`NAME        FILE  SOURCE                                VALUE    STATUS
+FOO         -     secretsmanager id=foo/bar             "BAZ"    ok
+HELLO       -     literal                               "world"  ok
+HOGE        -     parameterstore name=/hoge/fuga        "FUGA"   ok
+ZOO         -     secretsmanager id=foo/zoo key=TOKEN   "AAA"    ok
+ZOO_SECRET  -     secretsmanager id=foo/zoo key=SECRET  "BBB"    ok
+ZOO_TOKEN   -     secretsmanager id=foo/zoo key=TOKEN   "AAA"    ok
+`, out)
+}
+
+func Test_dryRun_Err(t *testing.T) {
+	assert := assert.New(t)
+	providers := newDryRunProviders(t)
+
+	envFrom := map[string]string{
+		"FOO":  "secretsmanager://foo/missing",
+		"BAR":  "secretsmanager://foo/bar?stage=AWSPENDING",
+		"HOGE": "parameterstore://hoge/missing",
+		"ZOO":  "world",
+	}
+
+	out, err := sev.DryRun(envFrom, nil, providers, false)
+	assert.EqualError(err, "dry run found 3 unreachable variable(s)")
+	assert.Contains(out, "BAR   -     secretsmanager id=foo/bar stage=AWSPENDING  -         error: stage could not be found in 'foo/bar': 'AWSPENDING'\n")
+	assert.Contains(out, "FOO   -     secretsmanager id=foo/missing               -         error: operation error Secrets Manager: DescribeSecret")
+	assert.Contains(out, "HOGE  -     parameterstore name=/hoge/missing           -         error: operation error SSM: GetParameter")
+	assert.Contains(out, "ZOO   -     literal                                     ********  ok\n")
+}
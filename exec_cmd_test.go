@@ -87,3 +87,43 @@ func Test_execCmd_Err(t *testing.T) {
 	assert.Empty(bufout.String())
 	assert.NotEmpty(buferr.String())
 }
+
+func Test_execCmd_OverrideEnv(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	t.Setenv("FOO", "ORIGINAL")
+	cmd := []string{"/bin/sh", "-c", "env | grep ^FOO="}
+	env := map[string]string{
+		"FOO": "BAR",
+	}
+
+	bufout := &bytes.Buffer{}
+	buferr := &bytes.Buffer{}
+	_stdout = bufout
+	_stderr = buferr
+
+	defer func() {
+		_stdout = os.Stdout
+		_stderr = os.Stderr
+	}()
+
+	err := execCmd(cmd, env)
+	require.NoError(err)
+	assert.Equal("FOO=BAR\n", bufout.String())
+	assert.Empty(buferr.String())
+}
+
+func Test_execCmd_ExitCode(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cmd := []string{"/bin/sh", "-c", "exit 3"}
+
+	err := execCmd(cmd, map[string]string{})
+	require.Error(err)
+	var exitErr *ExitError
+	require.ErrorAs(err, &exitErr)
+	assert.Equal(3, exitErr.Code)
+	assert.EqualError(err, "exit status 3")
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package sev
+
+func execve(cmdArgs []string, extraEnv map[string]string) error {
+	return execCmd(cmdArgs, extraEnv)
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package sev
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func execve(cmdArgs []string, extraEnv map[string]string) error {
+	path, err := exec.LookPath(cmdArgs[0])
+
+	if err != nil {
+		return err
+	}
+
+	return syscall.Exec(path, cmdArgs, buildEnv(extraEnv))
+}
@@ -0,0 +1,36 @@
+//go:build unix
+
+package sev
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_execve_OK(t *testing.T) {
+	if os.Getenv("SEV_TEST_EXECVE") == "1" {
+		err := execve([]string{"/bin/sh", "-c", "echo $FOO $ZOO $$"}, map[string]string{"FOO": "BAR", "ZOO": "BAZ"})
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^Test_execve_OK$")
+	cmd.Env = append(os.Environ(), "SEV_TEST_EXECVE=1", "FOO=ORIGINAL")
+	out, err := cmd.Output()
+	require.NoError(err)
+	assert.Equal(fmt.Sprintf("BAR BAZ %d\n", cmd.Process.Pid), string(out))
+}
+
+func Test_execve_Err(t *testing.T) {
+	assert := assert.New(t)
+	err := execve([]string{"/not/exists"}, map[string]string{})
+	assert.ErrorContains(err, "no such file or directory")
+}
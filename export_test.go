@@ -1,8 +1,126 @@
 package sev
 
+import (
+	"bytes"
+	"os"
+	"time"
+)
+
 var (
-	LoadEnvFrom    = loadEnvFrom
-	LoadEnv        = loadEnv
-	GetSecretValue = getSecretValue
-	GetParameter   = getParameter
+	GetSecretValue      = getSecretValue
+	GetSecretValues     = getSecretValues
+	ExtractSecretKey    = extractSecretKey
+	GetParameters       = getParameters
+	GetParametersByPath = getParametersByPath
+	FormatEnv           = formatEnv
+	DescribeSecret      = describeSecret
+	GetParameter        = getParameter
+	ExportCredentials   = (*Providers).exportCredentials
+	ParseDotenv         = parseDotenv
+	SplitCommandLine    = splitCommandLine
 )
+
+func LoadEnv(envFrom map[string]string, files map[string]string, providers ProviderssIface, concurrency int) (map[string]string, error) {
+	return loadEnv(envFrom, files, newRegistry(providers), concurrency)
+}
+
+func registryWith(providers []Provider) *registry {
+	reg := newRegistry(nil)
+
+	for _, p := range providers {
+		reg.register(p)
+	}
+
+	return reg
+}
+
+// LoadEnvWith resolves envFrom with the built-in providers replaced or extended by the given ones.
+func LoadEnvWith(envFrom map[string]string, files map[string]string, providers ...Provider) (map[string]string, error) {
+	return loadEnv(envFrom, files, registryWith(providers), 1)
+}
+
+func DryRunWith(envFrom map[string]string, reveal bool, providers ...Provider) (string, error) {
+	buf := &bytes.Buffer{}
+	_stdout = buf
+	defer func() { _stdout = os.Stdout }()
+	err := dryRun(envFrom, nil, registryWith(providers), reveal)
+	return buf.String(), err
+}
+
+func NewCmdProvider(allow []string, timeout time.Duration) Provider {
+	return &cmdProvider{allow: allow, timeout: timeout}
+}
+
+func DryRun(envFrom map[string]string, files map[string]string, providers ProviderssIface, reveal bool) (string, error) {
+	buf := &bytes.Buffer{}
+	_stdout = buf
+	defer func() { _stdout = os.Stdout }()
+	err := dryRun(envFrom, files, newRegistry(providers), reveal)
+	return buf.String(), err
+}
+
+func ParseParameterRef(from string) (string, AWSTarget, error) {
+	ref, err := parseParameterRef(from)
+
+	if err != nil {
+		return "", AWSTarget{}, err
+	}
+
+	return ref.name, ref.target, nil
+}
+
+func ParseSecretRef(from string) (string, string, AWSTarget, error) {
+	ref, err := parseSecretRef(from)
+
+	if err != nil {
+		return "", "", AWSTarget{}, err
+	}
+
+	return ref.secretID, ref.key, ref.target, nil
+}
+
+func LoadEnvFrom(configGlob string, profile string, fallback string) (map[string]string, map[string]string, error) {
+	p, err := loadProfile(configGlob, profile, fallback)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return p.env, p.files, nil
+}
+
+func LoadAWSSettings(configGlob string, profile string, fallback string) (*AWSSettings, error) {
+	p, err := loadProfile(configGlob, profile, fallback)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseAWSSettings(p.settings)
+}
+
+func NewVaultProvider(settings *VaultSettings) Provider {
+	return &vaultProvider{settings: settings}
+}
+
+func LoadVaultSettings(configGlob string, profile string) (*VaultSettings, error) {
+	p, err := loadProfile(configGlob, profile, "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseVaultSettings(p.settings)
+}
+
+func SetVaultTimeout(d time.Duration) func() {
+	orig := _vaultTimeout
+	_vaultTimeout = d
+	return func() { _vaultTimeout = orig }
+}
+
+func SetMFATokenProvider(f func() (string, error)) func() {
+	orig := _mfaTokenProvider
+	_mfaTokenProvider = f
+	return func() { _mfaTokenProvider = orig }
+}
@@ -0,0 +1,121 @@
+package sev_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/winebarrel/sev"
+)
+
+func Test_extractSecretKey_OK(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	secret := `{"HOGE":"FUGA","PIYO":"HOGERA"}`
+
+	{
+		value, err := sev.ExtractSecretKey("foo/bar/zoo", secret, "HOGE")
+		require.NoError(err)
+		assert.Equal("FUGA", value)
+	}
+
+	{
+		value, err := sev.ExtractSecretKey("foo/bar/zoo", secret, "PIYO")
+		require.NoError(err)
+		assert.Equal("HOGERA", value)
+	}
+}
+
+func Test_extractSecretKey_Err_JSON(t *testing.T) {
+	assert := assert.New(t)
+	_, err := sev.ExtractSecretKey("foo/bar/zoo", `{`, "HOGE")
+	assert.ErrorContains(err, "failed to parse 'foo/bar/zoo'")
+}
+
+func Test_extractSecretKey_Err_KeyNotFound(t *testing.T) {
+	assert := assert.New(t)
+	_, err := sev.ExtractSecretKey("foo/bar/zoo", `{"HOGE":"FUGA","PIYO":"HOGERA"}`, "BAZ")
+	assert.ErrorContains(err, "key could not be found in 'foo/bar/zoo': 'BAZ'")
+}
+
+func Test_extractSecretKey_OK_Nested(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	secret := `{
+		"db": {"host": "localhost", "port": 5432, "ssl": true, "hosts": ["a", "b"], "opts": {"x": 1.5, "y": null}},
+		"db.host": "dotted",
+		"big": 12345678901234567890,
+		"html": "<&>"
+	}`
+
+	tt := map[string]string{
+		"db.host":       "dotted",
+		"$.db.host":     "localhost",
+		"db.port":       "5432",
+		"db.ssl":        "true",
+		"db.hosts[1]":   "b",
+		"db.hosts":      `["a","b"]`,
+		"db.opts":       `{"x":1.5,"y":null}`,
+		"db.opts.y":     "null",
+		"$.db.hosts[0]": "a",
+		"$.db.port":     "5432",
+		`$["db.host"]`:  "dotted",
+		`$['db'].host`:  "localhost",
+		"big":           "12345678901234567890",
+		"html":          "<&>",
+	}
+
+	for key, expected := range tt {
+		value, err := sev.ExtractSecretKey("foo/bar/zoo", secret, key)
+		require.NoError(err, key)
+		assert.Equal(expected, value, key)
+	}
+}
+
+func Test_extractSecretKey_OK_Null(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	secret := `{"none": null, "empty": "", "db": {"password": null}}`
+
+	tt := map[string]string{
+		"none":        "null",
+		"empty":       "",
+		"db.password": "null",
+	}
+
+	for key, expected := range tt {
+		value, err := sev.ExtractSecretKey("foo/bar/zoo", secret, key)
+		require.NoError(err, key)
+		assert.Equal(expected, value, key)
+	}
+}
+
+func Test_extractSecretKey_Err_Nested(t *testing.T) {
+	assert := assert.New(t)
+
+	secret := `{"db": {"host": "localhost", "hosts": ["a", "b"]}}`
+
+	tt := map[string]string{
+		"db.port":       "key could not be found in 'foo/bar/zoo': 'db.port'",
+		"db.hosts[2]":   "key could not be found in 'foo/bar/zoo': 'db.hosts[2]'",
+		"db.host.name":  "key could not be found in 'foo/bar/zoo': 'db.host.name'",
+		"$.db.hosts[x]": "invalid key in 'foo/bar/zoo': invalid index in path: '$.db.hosts[x]'",
+		"$.db.hosts[0":  "invalid key in 'foo/bar/zoo': unclosed bracket in path: '$.db.hosts[0'",
+		"db..host":      "invalid key in 'foo/bar/zoo': empty name in path: 'db..host'",
+		"$db":           "invalid key in 'foo/bar/zoo': unexpected character 'd' in path: '$db'",
+	}
+
+	for key, expected := range tt {
+		_, err := sev.ExtractSecretKey("foo/bar/zoo", secret, key)
+		assert.EqualError(err, expected, key)
+	}
+}
+
+func Test_extractSecretKey_Err_NotObject(t *testing.T) {
+	assert := assert.New(t)
+	_, err := sev.ExtractSecretKey("foo/bar/zoo", `"BAZ"`, "HOGE")
+	assert.EqualError(err, "key could not be found in 'foo/bar/zoo': 'HOGE'")
+}
@@ -0,0 +1,66 @@
+package sev
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var reShellName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func formatEnv(env map[string]string, format string) (string, error) {
+	if format == "json" {
+		buf := &bytes.Buffer{}
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(env)
+
+		if err != nil {
+			return "", err
+		}
+
+		return buf.String(), nil
+	}
+
+	var line func(name string, value string) string
+
+	switch format {
+	case "bash", "zsh":
+		line = func(name string, value string) string {
+			return fmt.Sprintf("export %s='%s'\n", name, strings.ReplaceAll(value, "'", `'\''`))
+		}
+	case "fish":
+		line = func(name string, value string) string {
+			value = strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value)
+			return fmt.Sprintf("set -gx %s '%s';\n", name, value)
+		}
+	case "powershell":
+		line = func(name string, value string) string {
+			return fmt.Sprintf("$env:%s = '%s'\n", name, strings.ReplaceAll(value, "'", "''"))
+		}
+	case "dotenv":
+		line = func(name string, value string) string {
+			value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`).Replace(value)
+			return fmt.Sprintf("%s=\"%s\"\n", name, value)
+		}
+	default:
+		return "", fmt.Errorf("unknown format: %s", format)
+	}
+
+	out := &strings.Builder{}
+
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		if !reShellName.MatchString(name) {
+			return "", fmt.Errorf("invalid variable name for %s: %s", format, name)
+		}
+
+		out.WriteString(line(name, env[name]))
+	}
+
+	return out.String(), nil
+}
@@ -0,0 +1,78 @@
+package sev_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/winebarrel/sev"
+)
+
+func Test_formatEnv_OK(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	env := map[string]string{
+		"FOO": "bar",
+		"ZOO": "it's $HOME\\n\"x\"\nnext",
+	}
+
+	tt := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format:   "bash",
+			expected: "export FOO='bar'\nexport ZOO='it'\\''s $HOME\\n\"x\"\nnext'\n",
+		},
+		{
+			format:   "zsh",
+			expected: "export FOO='bar'\nexport ZOO='it'\\''s $HOME\\n\"x\"\nnext'\n",
+		},
+		{
+			format:   "fish",
+			expected: "set -gx FOO 'bar';\nset -gx ZOO 'it\\'s $HOME\\\\n\"x\"\nnext';\n",
+		},
+		{
+			format:   "powershell",
+			expected: "$env:FOO = 'bar'\n$env:ZOO = 'it''s $HOME\\n\"x\"\nnext'\n",
+		},
+		{
+			format:   "dotenv",
+			expected: "FOO=\"bar\"\nZOO=\"it's \\$HOME\\\\n\\\"x\\\"\\nnext\"\n",
+		},
+		{
+			format:   "json",
+			expected: "{\n  \"FOO\": \"bar\",\n  \"ZOO\": \"it's $HOME\\\\n\\\"x\\\"\\nnext\"\n}\n",
+		},
+	}
+
+	for _, tc := range tt {
+		out, err := sev.FormatEnv(env, tc.format)
+		require.NoError(err)
+		assert.Equal(tc.expected, out, tc.format)
+	}
+}
+
+func Test_formatEnv_OK_Empty(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	out, err := sev.FormatEnv(map[string]string{}, "bash")
+	require.NoError(err)
+	assert.Empty(out)
+}
+
+func Test_formatEnv_Err_InvalidName(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := sev.FormatEnv(map[string]string{"FOO-BAR": "baz"}, "bash")
+	assert.EqualError(err, "invalid variable name for bash: FOO-BAR")
+}
+
+func Test_formatEnv_Err_UnknownFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := sev.FormatEnv(map[string]string{"FOO": "bar"}, "csh")
+	assert.EqualError(err, "unknown format: csh")
+}
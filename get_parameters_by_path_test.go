@@ -0,0 +1,71 @@
+package sev_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/winebarrel/sev"
+)
+
+type mockGetParametersByPathAPI func(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error)
+
+func (m mockGetParametersByPathAPI) GetParametersByPath(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+func Test_getParametersByPath_OK(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	svc := mockGetParametersByPathAPI(func(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error) {
+		assert.Equal("/myapp/prod", aws.ToString(params.Path))
+		assert.True(aws.ToBool(params.Recursive))
+		assert.True(aws.ToBool(params.WithDecryption))
+
+		if params.NextToken == nil {
+			outout := &ssm.GetParametersByPathOutput{
+				Parameters: []types.Parameter{
+					{Name: aws.String("/myapp/prod/db-host"), Value: aws.String("localhost")},
+				},
+				NextToken: aws.String("next"),
+			}
+
+			return outout, nil
+		}
+
+		assert.Equal("next", aws.ToString(params.NextToken))
+
+		outout := &ssm.GetParametersByPathOutput{
+			Parameters: []types.Parameter{
+				{Name: aws.String("/myapp/prod/api/token"), Value: aws.String("TOKEN")},
+			},
+		}
+
+		return outout, nil
+	})
+
+	values, err := sev.GetParametersByPath(context.Background(), svc, "/myapp/prod", true)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"/myapp/prod/db-host":   "localhost",
+		"/myapp/prod/api/token": "TOKEN",
+	}, values)
+}
+
+func Test_getParametersByPath_Err(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := mockGetParametersByPathAPI(func(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error) {
+		return nil, errors.New("unexpected error")
+	})
+
+	_, err := sev.GetParametersByPath(context.Background(), svc, "/myapp/prod", false)
+
+	assert.ErrorContains(err, "unexpected error")
+}
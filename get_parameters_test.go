@@ -0,0 +1,105 @@
+package sev_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/winebarrel/sev"
+)
+
+type mockGetParametersAPI func(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error)
+
+func (m mockGetParametersAPI) GetParameters(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+func Test_getParameters_OK(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	svc := mockGetParametersAPI(func(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+		assert.Equal([]string{"/foo/bar/zoo", "/hoge/fuga/piyo"}, params.Names)
+		assert.True(aws.ToBool(params.WithDecryption))
+
+		outout := &ssm.GetParametersOutput{
+			Parameters: []types.Parameter{
+				{Name: aws.String("/foo/bar/zoo"), Value: aws.String("BAZ")},
+				{Name: aws.String("/hoge/fuga/piyo"), Value: aws.String("HOGERA")},
+			},
+		}
+
+		return outout, nil
+	})
+
+	values, invalid, err := sev.GetParameters(context.Background(), svc, []string{"/foo/bar/zoo", "/hoge/fuga/piyo"})
+	require.NoError(err)
+	assert.Equal(map[string]string{"/foo/bar/zoo": "BAZ", "/hoge/fuga/piyo": "HOGERA"}, values)
+	assert.Empty(invalid)
+}
+
+func Test_getParameters_OK_InvalidParameters(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	svc := mockGetParametersAPI(func(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+		outout := &ssm.GetParametersOutput{
+			Parameters: []types.Parameter{
+				{Name: aws.String("/foo/bar/zoo"), Value: aws.String("BAZ")},
+			},
+			InvalidParameters: []string{"/hoge/fuga/piyo"},
+		}
+
+		return outout, nil
+	})
+
+	values, invalid, err := sev.GetParameters(context.Background(), svc, []string{"/foo/bar/zoo", "/hoge/fuga/piyo"})
+	require.NoError(err)
+	assert.Equal(map[string]string{"/foo/bar/zoo": "BAZ"}, values)
+	assert.Equal([]string{"/hoge/fuga/piyo"}, invalid)
+}
+
+func Test_getParameters_OK_Selector(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	svc := mockGetParametersAPI(func(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+		assert.Equal([]string{"/foo/bar/zoo", "/foo/bar/zoo:3", "/foo/bar/zoo:prod-label"}, params.Names)
+
+		outout := &ssm.GetParametersOutput{
+			Parameters: []types.Parameter{
+				{Name: aws.String("/foo/bar/zoo"), Value: aws.String("BAZ"), Version: 5},
+				{Name: aws.String("/foo/bar/zoo"), Value: aws.String("BAZ3"), Version: 3, Selector: aws.String(":3")},
+				{Name: aws.String("/foo/bar/zoo"), Value: aws.String("BAZ4"), Version: 4, Selector: aws.String(":prod-label")},
+			},
+		}
+
+		return outout, nil
+	})
+
+	values, invalid, err := sev.GetParameters(context.Background(), svc, []string{"/foo/bar/zoo", "/foo/bar/zoo:3", "/foo/bar/zoo:prod-label"})
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"/foo/bar/zoo":            "BAZ",
+		"/foo/bar/zoo:3":          "BAZ3",
+		"/foo/bar/zoo:prod-label": "BAZ4",
+	}, values)
+	assert.Empty(invalid)
+}
+
+func Test_getParameters_Err(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := mockGetParametersAPI(func(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error) {
+		return nil, errors.New("unexpected error")
+	})
+
+	_, _, err := sev.GetParameters(context.Background(), svc, []string{"/foo/bar/zoo"})
+
+	assert.ErrorContains(err, "unexpected error")
+}
@@ -32,79 +32,109 @@ func Test_getSecretValue_OK(t *testing.T) {
 		return outout, nil
 	})
 
-	value, err := sev.GetSecretValue(svc, "foo/bar/zoo")
+	value, err := sev.GetSecretValue(context.Background(), svc, "foo/bar/zoo")
 
 	require.NoError(err)
-	assert.Equal("BAZ", value)
+	assert.Equal("BAZ", value.String())
 }
 
-func Test_getSecretValue_OK_JSON(t *testing.T) {
+func Test_getSecretValue_Err(t *testing.T) {
 	assert := assert.New(t)
-	require := require.New(t)
 
 	svc := mockGetSecretValueAPI(func(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
-		assert.Equal("foo/bar/zoo", aws.ToString(params.SecretId))
+		return nil, errors.New("unexpected error")
+	})
 
-		outout := &secretsmanager.GetSecretValueOutput{
-			SecretString: aws.String(`{"HOGE":"FUGA","PIYO":"HOGERA"}`),
-		}
+	_, err := sev.GetSecretValue(context.Background(), svc, "foo/bar/zoo")
 
-		return outout, nil
+	assert.ErrorContains(err, "unexpected error")
+}
+
+func Test_getSecretValue_Err_Canceled(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := mockGetSecretValueAPI(func(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+		return nil, ctx.Err()
 	})
 
-	{
-		value, err := sev.GetSecretValue(svc, "foo/bar/zoo:HOGE")
-		require.NoError(err)
-		assert.Equal("FUGA", value)
-	}
-
-	{
-		value, err := sev.GetSecretValue(svc, "foo/bar/zoo:PIYO")
-		require.NoError(err)
-		assert.Equal("HOGERA", value)
-	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := sev.GetSecretValue(ctx, svc, "foo/bar/zoo")
+
+	assert.ErrorIs(err, context.Canceled)
 }
 
-func Test_getSecretValue_Err(t *testing.T) {
+func Test_getSecretValue_OK_VersionStage(t *testing.T) {
 	assert := assert.New(t)
+	require := require.New(t)
 
 	svc := mockGetSecretValueAPI(func(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
-		return nil, errors.New("unexpected error")
+		assert.Equal("foo/bar/zoo", aws.ToString(params.SecretId))
+		assert.Equal("AWSPREVIOUS", aws.ToString(params.VersionStage))
+		assert.Nil(params.VersionId)
+
+		outout := &secretsmanager.GetSecretValueOutput{
+			SecretString: aws.String("BAZ"),
+		}
+
+		return outout, nil
 	})
 
-	_, err := sev.GetSecretValue(svc, "foo/bar/zoo")
+	value, err := sev.GetSecretValue(context.Background(), svc, "foo/bar/zoo?stage=AWSPREVIOUS")
 
-	assert.ErrorContains(err, "unexpected error")
+	require.NoError(err)
+	assert.Equal("BAZ", value.String())
 }
 
-func Test_getSecretValue_Err_JSON(t *testing.T) {
+func Test_getSecretValue_OK_VersionID(t *testing.T) {
 	assert := assert.New(t)
+	require := require.New(t)
 
 	svc := mockGetSecretValueAPI(func(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+		assert.Equal("foo/bar/zoo", aws.ToString(params.SecretId))
+		assert.Nil(params.VersionStage)
+		assert.Equal("5048d25e-e46f-4a6c-87d9-b358e5c5dfcf", aws.ToString(params.VersionId))
+
 		outout := &secretsmanager.GetSecretValueOutput{
-			SecretString: aws.String(`{`),
+			SecretString: aws.String("BAZ"),
 		}
 
 		return outout, nil
 	})
 
-	_, err := sev.GetSecretValue(svc, "foo/bar/zoo:HOGE")
-	assert.ErrorContains(err, "failed to parse 'foo/bar/zoo'")
+	value, err := sev.GetSecretValue(context.Background(), svc, "foo/bar/zoo?version_id=5048d25e-e46f-4a6c-87d9-b358e5c5dfcf")
+
+	require.NoError(err)
+	assert.Equal("BAZ", value.String())
 }
 
-func Test_getSecretValue_Err_KeyNotFound(t *testing.T) {
+func Test_getSecretValue_Err_UnknownQuery(t *testing.T) {
 	assert := assert.New(t)
 
 	svc := mockGetSecretValueAPI(func(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
-		assert.Equal("foo/bar/zoo", aws.ToString(params.SecretId))
+		assert.Fail("Must not call GetSecretValue")
+		return nil, nil
+	})
+
+	_, err := sev.GetSecretValue(context.Background(), svc, "foo/bar/zoo?version=1")
 
+	assert.ErrorContains(err, "unknown query parameter in 'foo/bar/zoo?version=1': 'version'")
+}
+
+func Test_getSecretValue_OK_Binary(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	svc := mockGetSecretValueAPI(func(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
 		outout := &secretsmanager.GetSecretValueOutput{
-			SecretString: aws.String(`{"HOGE":"FUGA","PIYO":"HOGERA"}`),
+			SecretBinary: []byte("BAZ\x00"),
 		}
 
 		return outout, nil
 	})
 
-	_, err := sev.GetSecretValue(svc, "foo/bar/zoo:BAZ")
-	assert.ErrorContains(err, "key could not be found in 'foo/bar/zoo': 'BAZ'")
+	value, err := sev.GetSecretValue(context.Background(), svc, "foo/bar/zoo")
+
+	require.NoError(err)
+	assert.Equal("QkFaAA==", value.String())
 }
@@ -0,0 +1,124 @@
+package sev_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/winebarrel/sev"
+)
+
+type mockBatchGetSecretValueAPI func(ctx context.Context, params *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error)
+
+func (m mockBatchGetSecretValueAPI) BatchGetSecretValue(ctx context.Context, params *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error) {
+	return m(ctx, params, optFns...)
+}
+
+func Test_getSecretValues_OK(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	svc := mockBatchGetSecretValueAPI(func(ctx context.Context, params *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error) {
+		assert.Equal([]string{"foo/bar/zoo", "arn:aws:secretsmanager:us-east-1:123456789012:secret:hoge/fuga/piyo-AbCdEf"}, params.SecretIdList)
+
+		outout := &secretsmanager.BatchGetSecretValueOutput{
+			SecretValues: []types.SecretValueEntry{
+				{
+					ARN:          aws.String("arn:aws:secretsmanager:us-east-1:123456789012:secret:foo/bar/zoo-AbCdEf"),
+					Name:         aws.String("foo/bar/zoo"),
+					SecretString: aws.String("BAZ"),
+				},
+				{
+					ARN:          aws.String("arn:aws:secretsmanager:us-east-1:123456789012:secret:hoge/fuga/piyo-AbCdEf"),
+					Name:         aws.String("hoge/fuga/piyo"),
+					SecretString: aws.String("HOGERA"),
+				},
+			},
+		}
+
+		return outout, nil
+	})
+
+	values, errs, err := sev.GetSecretValues(context.Background(), svc, []string{"foo/bar/zoo", "arn:aws:secretsmanager:us-east-1:123456789012:secret:hoge/fuga/piyo-AbCdEf"})
+	require.NoError(err)
+	require.Len(values, 2)
+	assert.Equal("BAZ", values["foo/bar/zoo"].String())
+	assert.Equal("HOGERA", values["arn:aws:secretsmanager:us-east-1:123456789012:secret:hoge/fuga/piyo-AbCdEf"].String())
+	assert.Empty(errs)
+}
+
+func Test_getSecretValues_OK_Errors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	svc := mockBatchGetSecretValueAPI(func(ctx context.Context, params *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error) {
+		outout := &secretsmanager.BatchGetSecretValueOutput{
+			SecretValues: []types.SecretValueEntry{
+				{
+					Name:         aws.String("foo/bar/zoo"),
+					SecretString: aws.String("BAZ"),
+				},
+			},
+			Errors: []types.APIErrorType{
+				{
+					SecretId:  aws.String("hoge/fuga/piyo"),
+					ErrorCode: aws.String("ResourceNotFoundException"),
+					Message:   aws.String("Secrets Manager can't find the specified secret."),
+				},
+			},
+		}
+
+		return outout, nil
+	})
+
+	values, errs, err := sev.GetSecretValues(context.Background(), svc, []string{"foo/bar/zoo", "hoge/fuga/piyo"})
+	require.NoError(err)
+	require.Len(values, 1)
+	assert.Equal("BAZ", values["foo/bar/zoo"].String())
+	require.Len(errs, 1)
+	assert.EqualError(errs["hoge/fuga/piyo"], "ResourceNotFoundException: Secrets Manager can't find the specified secret.")
+}
+
+func Test_getSecretValues_Err(t *testing.T) {
+	assert := assert.New(t)
+
+	svc := mockBatchGetSecretValueAPI(func(ctx context.Context, params *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error) {
+		return nil, errors.New("unexpected error")
+	})
+
+	_, _, err := sev.GetSecretValues(context.Background(), svc, []string{"foo/bar/zoo", "hoge/fuga/piyo"})
+
+	assert.ErrorContains(err, "unexpected error")
+}
+
+func Test_getSecretValues_OK_Binary(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	svc := mockBatchGetSecretValueAPI(func(ctx context.Context, params *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error) {
+		outout := &secretsmanager.BatchGetSecretValueOutput{
+			SecretValues: []types.SecretValueEntry{
+				{
+					Name:         aws.String("foo/bar/zoo"),
+					SecretBinary: []byte{0x00, 0xff},
+				},
+				{
+					Name:         aws.String("hoge/fuga/piyo"),
+					SecretString: aws.String("HOGERA"),
+				},
+			},
+		}
+
+		return outout, nil
+	})
+
+	values, _, err := sev.GetSecretValues(context.Background(), svc, []string{"foo/bar/zoo", "hoge/fuga/piyo"})
+	require.NoError(err)
+	assert.Equal("AP8=", values["foo/bar/zoo"].String())
+	assert.Equal("HOGERA", values["hoge/fuga/piyo"].String())
+}
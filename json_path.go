@@ -0,0 +1,162 @@
+package sev
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func decodeJSON(data string) (any, error) {
+	var v any
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+	err := dec.Decode(&v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if dec.More() {
+		return nil, fmt.Errorf("invalid character after top-level value")
+	}
+
+	return v, nil
+}
+
+// selectJSONKey renders the value of a top-level key, or of a path if there is no such key.
+// name identifies the document in errors.
+func selectJSONKey(name string, jsonValue any, key string) (string, error) {
+	obj, _ := jsonValue.(map[string]any)
+	keyValue, ok := obj[key]
+
+	if !ok || strings.HasPrefix(key, "$") {
+		var err error
+		keyValue, ok, err = lookupJSONPath(jsonValue, key)
+
+		if err != nil {
+			return "", fmt.Errorf("invalid key in '%s': %w", name, err)
+		}
+	}
+
+	if !ok {
+		return "", fmt.Errorf("key could not be found in '%s': '%s'", name, key)
+	}
+
+	return renderJSONValue(keyValue)
+}
+
+// lookupJSONPath walks a decoded JSON document.
+// The path is either a dotted path ("db.hosts[0]") or a JSONPath-like selector ("$.db.hosts[0]", `$["db.host"]`).
+func lookupJSONPath(doc any, path string) (any, bool, error) {
+	rest := path
+
+	if strings.HasPrefix(rest, "$") {
+		rest = rest[1:]
+	} else {
+		rest = "." + rest
+	}
+
+	cur := doc
+
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+
+			if end < 0 {
+				end = len(rest)
+			}
+
+			name := rest[:end]
+			rest = rest[end:]
+
+			if name == "" {
+				return nil, false, fmt.Errorf("empty name in path: '%s'", path)
+			}
+
+			obj, ok := cur.(map[string]any)
+
+			if !ok {
+				return nil, false, nil
+			}
+
+			cur, ok = obj[name]
+
+			if !ok {
+				return nil, false, nil
+			}
+		case '[':
+			end := strings.Index(rest, "]")
+
+			if end < 0 {
+				return nil, false, fmt.Errorf("unclosed bracket in path: '%s'", path)
+			}
+
+			inner := rest[1:end]
+			rest = rest[end+1:]
+
+			if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0] {
+				obj, ok := cur.(map[string]any)
+
+				if !ok {
+					return nil, false, nil
+				}
+
+				cur, ok = obj[inner[1:len(inner)-1]]
+
+				if !ok {
+					return nil, false, nil
+				}
+
+				continue
+			}
+
+			idx, err := strconv.Atoi(inner)
+
+			if err != nil || idx < 0 {
+				return nil, false, fmt.Errorf("invalid index in path: '%s'", path)
+			}
+
+			arr, ok := cur.([]any)
+
+			if !ok || idx >= len(arr) {
+				return nil, false, nil
+			}
+
+			cur = arr[idx]
+		default:
+			return nil, false, fmt.Errorf("unexpected character '%c' in path: '%s'", rest[0], path)
+		}
+	}
+
+	return cur, true, nil
+}
+
+// renderJSONValue renders scalars in their natural string form and objects or arrays as compact JSON.
+// null is rendered as "null" so that it is not mistaken for an empty string.
+func renderJSONValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "null", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(v)
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
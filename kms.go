@@ -0,0 +1,111 @@
+package sev
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+const (
+	PrefixKMS = "kms://"
+)
+
+// kmsRef is a parsed "kms://" reference to an inline ciphertext:
+//
+//	<base64 ciphertext>[?context.<key>=<value>&...][&region=<region>][&aws_profile=<profile>]
+//
+// The "context." parameters are the encryption context that the value was encrypted with.
+type kmsRef struct {
+	ciphertext []byte
+	context    map[string]string
+	target     AWSTarget
+}
+
+func parseKMSRef(from string) (*kmsRef, error) {
+	blob, rawQuery, _ := strings.Cut(from, "?")
+	query, err := url.ParseQuery(rawQuery)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query of '%s': %w", from, err)
+	}
+
+	ref := &kmsRef{}
+
+	for name := range query {
+		if ref.target.setQuery(name, query.Get(name)) {
+			continue
+		}
+
+		key, ok := strings.CutPrefix(name, "context.")
+
+		if !ok || key == "" {
+			return nil, fmt.Errorf("unknown query parameter in '%s': '%s'", from, name)
+		}
+
+		if ref.context == nil {
+			ref.context = map[string]string{}
+		}
+
+		ref.context[key] = query.Get(name)
+	}
+
+	if blob == "" {
+		return nil, fmt.Errorf("ciphertext is empty: '%s'", from)
+	}
+
+	ref.ciphertext, err = base64.StdEncoding.DecodeString(blob)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ciphertext: %w", err)
+	}
+
+	return ref, nil
+}
+
+type KMSDecryptAPI interface {
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+func decryptKMS(ctx context.Context, api KMSDecryptAPI, ref *kmsRef) (string, error) {
+	input := &kms.DecryptInput{
+		CiphertextBlob:    ref.ciphertext,
+		EncryptionContext: ref.context,
+	}
+
+	output, err := api.Decrypt(ctx, input)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(output.Plaintext), nil
+}
+
+// kmsProvider resolves "kms://" references with kms:Decrypt.
+type kmsProvider struct {
+	clients ProviderssIface
+}
+
+func (p *kmsProvider) Scheme() string {
+	return strings.TrimSuffix(PrefixKMS, "://")
+}
+
+func (p *kmsProvider) Resolve(ctx context.Context, ref *Reference) (string, error) {
+	kref, err := parseKMSRef(ref.Path())
+
+	if err != nil {
+		return "", err
+	}
+
+	svc, err := p.clients.NewKMSClient(kref.target)
+
+	if err != nil {
+		return "", err
+	}
+
+	return decryptKMS(ctx, svc, kref)
+}
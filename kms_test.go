@@ -0,0 +1,129 @@
+package sev_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/winebarrel/sev"
+)
+
+func Test_loadEnv_KMS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://kms.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		assert.Equal("TrentService.Decrypt", req.Header.Get("X-Amz-Target"))
+
+		var input struct {
+			CiphertextBlob    []byte
+			EncryptionContext map[string]string
+		}
+
+		body, _ := io.ReadAll(req.Body)
+		err := json.Unmarshal(body, &input)
+		require.NoError(err)
+
+		switch string(input.CiphertextBlob) {
+		case "cipher1":
+			assert.Nil(input.EncryptionContext)
+			return httpmock.NewStringResponse(http.StatusOK, `{"Plaintext":"QkFa"}`), nil // BAZ
+		case "cipher2":
+			assert.Equal(map[string]string{"app": "web", "env": "prod"}, input.EncryptionContext)
+			return httpmock.NewStringResponse(http.StatusOK, `{"Plaintext":"SE9HRQ=="}`), nil // HOGE
+		}
+
+		return httpmock.NewStringResponse(http.StatusBadRequest, `{"__type":"InvalidCiphertextException"}`), nil
+	})
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	envFrom := map[string]string{
+		"FOO":  "kms://Y2lwaGVyMQ==",
+		"HOGE": "kms://Y2lwaGVyMg==?context.app=web&context.env=prod",
+	}
+
+	providers := &mockProviders{
+		newKMSClient: func() (*kms.Client, error) {
+			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+			require.NoError(err)
+			return kms.NewFromConfig(cfg), nil
+		},
+	}
+
+	env, err := sev.LoadEnv(envFrom, nil, providers, 1)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"FOO":  "BAZ",
+		"HOGE": "HOGE",
+	}, env)
+}
+
+func Test_loadEnv_KMS_Err(t *testing.T) {
+	tt := []struct {
+		from string
+		err  string
+	}{
+		{from: "kms://", err: "failed to get kms://: ciphertext is empty: ''"},
+		{from: "kms://!!!", err: "failed to get kms://!!!: failed to decode ciphertext: illegal base64 data at input byte 0"},
+		{from: "kms://Y2lwaGVyMQ==?label=prod", err: "failed to get kms://Y2lwaGVyMQ==?label=prod: unknown query parameter in 'Y2lwaGVyMQ==?label=prod': 'label'"},
+		{from: "kms://Y2lwaGVyMQ==?context.=prod", err: "failed to get kms://Y2lwaGVyMQ==?context.=prod: unknown query parameter in 'Y2lwaGVyMQ==?context.=prod': 'context.'"},
+	}
+
+	for _, t1 := range tt {
+		t.Run(t1.from, func(t *testing.T) {
+			_, err := sev.LoadEnv(map[string]string{"FOO": t1.from}, nil, &mockProviders{}, 1)
+			assert.EqualError(t, err, t1.err)
+		})
+	}
+}
+
+func Test_Providers_KMS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://sts.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, assumeRoleResponse("ASIAASSUMED")), nil
+	})
+
+	httpmock.RegisterResponder(http.MethodPost, "https://kms.eu-west-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		assert.Contains(req.Header.Get("Authorization"), "Credential=ASIAASSUMED/")
+		return httpmock.NewStringResponse(http.StatusOK, `{"Plaintext":"QkFa"}`), nil
+	})
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	settings := &sev.AWSSettings{
+		RoleARNs: []string{"arn:aws:iam::123456789012:role/sev"},
+	}
+
+	providers := sev.NewProviders(sev.AWSConfigOptFns{config.WithHTTPClient(hc)}, settings)
+	env, err := sev.LoadEnv(map[string]string{"FOO": "kms://Y2lwaGVyMQ==?region=eu-west-1"}, nil, providers, 1)
+	require.NoError(err)
+	assert.Equal(map[string]string{"FOO": "BAZ"}, env)
+
+	euSvc, err := providers.NewKMSClient(sev.AWSTarget{Region: "eu-west-1"})
+	require.NoError(err)
+	euSvc2, err := providers.NewKMSClient(sev.AWSTarget{Region: "eu-west-1"})
+	require.NoError(err)
+	assert.Same(euSvc, euSvc2)
+}
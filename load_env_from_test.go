@@ -3,6 +3,7 @@ package sev_test
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -24,11 +25,11 @@ piyo = "hogera"
 `)
 	tomlFile.Sync()
 
-	envAbc, err := sev.LoadEnvFrom(tomlFile.Name(), "abc", "")
+	envAbc, _, err := sev.LoadEnvFrom(tomlFile.Name(), "abc", "")
 	require.NoError(err)
 	assert.Equal(map[string]string{"FOO": "BAR", "ZOO": "BAZ"}, envAbc)
 
-	envDef, err := sev.LoadEnvFrom(tomlFile.Name(), "DEF", "")
+	envDef, _, err := sev.LoadEnvFrom(tomlFile.Name(), "DEF", "")
 	require.NoError(err)
 	assert.Equal(map[string]string{"hoge": "fuga", "piyo": "hogera"}, envDef)
 }
@@ -53,32 +54,32 @@ fuga = "hoge"
 hogera = "piyo"
 `), 0600)
 
-	envAbc, err := sev.LoadEnvFrom(d+"/*.toml", "abc", "")
+	envAbc, _, err := sev.LoadEnvFrom(d+"/*.toml", "abc", "")
 	require.NoError(err)
 	assert.Equal(map[string]string{"FOO": "BAR", "ZOO": "BAZ"}, envAbc)
 
-	envDef, err := sev.LoadEnvFrom(d+"/*.toml", "DEF", "")
+	envDef, _, err := sev.LoadEnvFrom(d+"/*.toml", "DEF", "")
 	require.NoError(err)
 	assert.Equal(map[string]string{"hoge": "fuga", "piyo": "hogera"}, envDef)
 
-	envGhi, err := sev.LoadEnvFrom(d+"/*.toml", "GHI", "")
+	envGhi, _, err := sev.LoadEnvFrom(d+"/*.toml", "GHI", "")
 	require.NoError(err)
 	assert.Equal(map[string]string{"OOF": "BAR", "OOZ": "BAZ"}, envGhi)
 
-	envJkl, err := sev.LoadEnvFrom(d+"/*.toml", "jkl", "")
+	envJkl, _, err := sev.LoadEnvFrom(d+"/*.toml", "jkl", "")
 	require.NoError(err)
 	assert.Equal(map[string]string{"fuga": "hoge", "hogera": "piyo"}, envJkl)
 }
 
 func Test_loadEnfFrom_Err_ConfigNotExists(t *testing.T) {
 	assert := assert.New(t)
-	_, err := sev.LoadEnvFrom("/not/exists", "abc", "")
+	_, _, err := sev.LoadEnvFrom("/not/exists", "abc", "")
 	assert.ErrorContains(err, "pattern does not exist")
 }
 
 func Test_loadEnfFrom_Err_ConfigGlobNotExists(t *testing.T) {
 	assert := assert.New(t)
-	_, err := sev.LoadEnvFrom("/not/*exists", "abc", "")
+	_, _, err := sev.LoadEnvFrom("/not/*exists", "abc", "")
 	assert.ErrorContains(err, "pattern does not exist")
 }
 
@@ -90,7 +91,7 @@ func Test_loadEnfFrom_Err_ParseError(t *testing.T) {
 	tomlFile.WriteString("xxx")
 	tomlFile.Sync()
 
-	_, err := sev.LoadEnvFrom(tomlFile.Name(), "abc", "")
+	_, _, err := sev.LoadEnvFrom(tomlFile.Name(), "abc", "")
 	assert.ErrorContains(err, "expected key separator '='")
 }
 
@@ -105,7 +106,7 @@ ZOO = "BAZ"
 `)
 	tomlFile.Sync()
 
-	_, err := sev.LoadEnvFrom(tomlFile.Name(), "DEF", "")
+	_, _, err := sev.LoadEnvFrom(tomlFile.Name(), "DEF", "")
 	assert.ErrorContains(err, "profile could not be found: DEF")
 }
 
@@ -124,7 +125,7 @@ ZOO = "zab"
 `)
 	tomlFile.Sync()
 
-	env, err := sev.LoadEnvFrom(tomlFile.Name(), "abc", "default")
+	env, _, err := sev.LoadEnvFrom(tomlFile.Name(), "abc", "default")
 	require.NoError(err)
 	assert.Equal(map[string]string{"FOO": "rab", "ZOO": "zab"}, env)
 }
@@ -143,6 +144,242 @@ ZOO = "zab"
 `)
 	tomlFile.Sync()
 
-	_, err := sev.LoadEnvFrom(tomlFile.Name(), "abc", "default")
+	_, _, err := sev.LoadEnvFrom(tomlFile.Name(), "abc", "default")
 	assert.ErrorContains(err, "fallback profile could not be found: default")
 }
+
+func Test_loadEnfFrom_Extends(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tomlFile, _ := os.CreateTemp("", "")
+	defer os.Remove(tomlFile.Name())
+	tomlFile.WriteString(`[base]
+FOO = "base-foo"
+BAR = "base-bar"
+ZOO = "base-zoo"
+[aws]
+extends = "base"
+AWS_PROFILE = "dev"
+BAR = "aws-bar"
+[prod]
+extends = ["aws", "common"]
+ZOO = "prod-zoo"
+[common]
+BAR = "common-bar"
+HOGE = "common-hoge"
+`)
+	tomlFile.Sync()
+
+	env, _, err := sev.LoadEnvFrom(tomlFile.Name(), "aws", "")
+	require.NoError(err)
+	assert.Equal(map[string]string{"FOO": "base-foo", "BAR": "aws-bar", "ZOO": "base-zoo", "AWS_PROFILE": "dev"}, env)
+
+	env, _, err = sev.LoadEnvFrom(tomlFile.Name(), "prod", "")
+	require.NoError(err)
+	assert.Equal(map[string]string{"FOO": "base-foo", "BAR": "common-bar", "ZOO": "prod-zoo", "AWS_PROFILE": "dev", "HOGE": "common-hoge"}, env)
+}
+
+func Test_loadEnfFrom_Extends_Fallback(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tomlFile, _ := os.CreateTemp("", "")
+	defer os.Remove(tomlFile.Name())
+	tomlFile.WriteString(`[base]
+FOO = "BAR"
+[default]
+extends = "base"
+ZOO = "BAZ"
+`)
+	tomlFile.Sync()
+
+	env, _, err := sev.LoadEnvFrom(tomlFile.Name(), "abc", "default")
+	require.NoError(err)
+	assert.Equal(map[string]string{"FOO": "BAR", "ZOO": "BAZ"}, env)
+}
+
+func Test_loadEnfFrom_Extends_Cycle(t *testing.T) {
+	assert := assert.New(t)
+
+	tomlFile, _ := os.CreateTemp("", "")
+	defer os.Remove(tomlFile.Name())
+	tomlFile.WriteString(`[abc]
+extends = "def"
+[def]
+extends = ["ghi"]
+[ghi]
+extends = "abc"
+`)
+	tomlFile.Sync()
+
+	_, _, err := sev.LoadEnvFrom(tomlFile.Name(), "abc", "")
+	assert.EqualError(err, "profile inheritance cycle: abc -> def -> ghi -> abc")
+}
+
+func Test_loadEnfFrom_Extends_ParentNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	tomlFile, _ := os.CreateTemp("", "")
+	defer os.Remove(tomlFile.Name())
+	tomlFile.WriteString(`[abc]
+extends = "def"
+`)
+	tomlFile.Sync()
+
+	_, _, err := sev.LoadEnvFrom(tomlFile.Name(), "abc", "")
+	assert.EqualError(err, "parent profile could not be found: def (extended by abc in "+tomlFile.Name()+")")
+}
+
+func Test_loadEnfFrom_Extends_Invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	tomlFile, _ := os.CreateTemp("", "")
+	defer os.Remove(tomlFile.Name())
+	tomlFile.WriteString(`[abc]
+extends = 1
+`)
+	tomlFile.Sync()
+
+	_, _, err := sev.LoadEnvFrom(tomlFile.Name(), "abc", "")
+	assert.ErrorContains(err, "extends must be a string or an array of strings")
+}
+
+func Test_loadEnfFrom_Merge(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := t.TempDir()
+	os.WriteFile(d+"/20-override.toml", []byte(`[abc]
+BAR = "override-bar"
+ZOO = "override-zoo"
+[def]
+extends = "abc"
+`), 0600)
+	os.WriteFile(d+"/10-base.toml", []byte(`[abc]
+FOO = "base-foo"
+BAR = "base-bar"
+[def]
+extends = "ghi"
+HOGE = "base-hoge"
+`), 0600)
+
+	env, files, err := sev.LoadEnvFrom(d+"/*.toml", "abc", "")
+	require.NoError(err)
+	assert.Equal(map[string]string{"FOO": "base-foo", "BAR": "override-bar", "ZOO": "override-zoo"}, env)
+	assert.Equal(map[string]string{"FOO": d + "/10-base.toml", "BAR": d + "/20-override.toml", "ZOO": d + "/20-override.toml"}, files)
+
+	env, files, err = sev.LoadEnvFrom(d+"/*.toml", "def", "")
+	require.NoError(err)
+	assert.Equal(map[string]string{"FOO": "base-foo", "BAR": "override-bar", "ZOO": "override-zoo", "HOGE": "base-hoge"}, env)
+	assert.Equal(d+"/10-base.toml", files["HOGE"])
+}
+
+func Test_loadEnfFrom_Err_ParseErrorWithFile(t *testing.T) {
+	assert := assert.New(t)
+
+	d := t.TempDir()
+	os.WriteFile(d+"/a.toml", []byte(`[abc]
+FOO = "BAR"
+`), 0600)
+	os.WriteFile(d+"/b.toml", []byte(`[abc]
+FOO = 1
+`), 0600)
+
+	_, _, err := sev.LoadEnvFrom(d+"/*.toml", "abc", "")
+	assert.ErrorContains(err, "failed to parse "+d+"/b.toml: ")
+	assert.ErrorContains(err, "value of FOO must be a string")
+}
+
+func Test_loadEnfFrom_Settings(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tomlFile, _ := os.CreateTemp("", "")
+	defer os.Remove(tomlFile.Name())
+	tomlFile.WriteString(`[base]
+FOO = "BAR"
+[base._sev]
+region = "us-west-2"
+endpoint_url = "http://localhost:4566"
+[prod]
+extends = "base"
+ZOO = "BAZ"
+[prod._sev]
+region = "ap-northeast-1"
+role_arn = "arn:aws:iam::123456789012:role/sev"
+external_id = "EXTERNAL"
+duration = "1h"
+credential_process = "get-credentials"
+`)
+	tomlFile.Sync()
+
+	env, _, err := sev.LoadEnvFrom(tomlFile.Name(), "prod", "")
+	require.NoError(err)
+	assert.Equal(map[string]string{"FOO": "BAR", "ZOO": "BAZ"}, env)
+
+	settings, err := sev.LoadAWSSettings(tomlFile.Name(), "prod", "")
+	require.NoError(err)
+	assert.Equal(&sev.AWSSettings{
+		Region:            "ap-northeast-1",
+		RoleARNs:          []string{"arn:aws:iam::123456789012:role/sev"},
+		ExternalID:        "EXTERNAL",
+		EndpointURL:       "http://localhost:4566",
+		Duration:          time.Hour,
+		CredentialProcess: "get-credentials",
+	}, settings)
+
+	settings, err = sev.LoadAWSSettings(tomlFile.Name(), "base", "")
+	require.NoError(err)
+	assert.Equal(&sev.AWSSettings{Region: "us-west-2", EndpointURL: "http://localhost:4566"}, settings)
+}
+
+func Test_loadEnfFrom_Settings_RoleChain(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tomlFile, _ := os.CreateTemp("", "")
+	defer os.Remove(tomlFile.Name())
+	tomlFile.WriteString(`[security]
+FOO = "secretsmanager://foo"
+[security._sev]
+role_arn = ["arn:aws:iam::111111111111:role/hop1", "arn:aws:iam::222222222222:role/hop2"]
+mfa_serial = "arn:aws:iam::000000000000:mfa/me"
+session_name = "sev"
+export_credentials = true
+`)
+	tomlFile.Sync()
+
+	settings, err := sev.LoadAWSSettings(tomlFile.Name(), "security", "")
+	require.NoError(err)
+	assert.Equal(&sev.AWSSettings{
+		RoleARNs:          []string{"arn:aws:iam::111111111111:role/hop1", "arn:aws:iam::222222222222:role/hop2"},
+		MFASerial:         "arn:aws:iam::000000000000:mfa/me",
+		SessionName:       "sev",
+		ExportCredentials: true,
+	}, settings)
+}
+
+func Test_loadEnfFrom_Settings_Err(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := map[string]string{
+		"region = \"us-east-1\"\nprofile = \"foo\"": "unknown key in _sev: profile",
+		"duration = 3600":                       "value of duration in _sev must be a string",
+		"role_arn = \"arn\"\nduration = \"1x\"": `invalid duration in _sev: time: unknown unit "x" in duration "1x"`,
+		"external_id = \"EXTERNAL\"":            "external_id, session_name, mfa_serial and duration in _sev require role_arn",
+		"role_arn = []":                         "value of role_arn in _sev must be a string or a non-empty array of strings",
+		"role_arn = [\"arn\", 1]":               "value of role_arn in _sev must be a string or a non-empty array of strings",
+		"export_credentials = \"yes\"":          "value of export_credentials in _sev must be a boolean",
+	}
+
+	for settings, expected := range tt {
+		tomlFile, _ := os.CreateTemp("", "")
+		defer os.Remove(tomlFile.Name())
+		tomlFile.WriteString("[abc]\nFOO = \"BAR\"\n[abc._sev]\n" + settings + "\n")
+		tomlFile.Sync()
+
+		_, err := sev.LoadAWSSettings(tomlFile.Name(), "abc", "")
+		assert.ErrorContains(err, expected)
+	}
+}
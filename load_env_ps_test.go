@@ -2,6 +2,7 @@ package sev_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -27,28 +28,31 @@ func Test_loadEnv_PS_OK(t *testing.T) {
 
 	httpmock.RegisterResponder(http.MethodPost, "https://ssm.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
 		body, _ := io.ReadAll(req.Body)
-		val := ""
+		assert.Equal(`{"Names":["/foo/bar/zoo","/hoge/fuga/piyo"],"WithDecryption":true}`, string(body))
 
-		switch string(body) {
-		case `{"Name":"/foo/bar/zoo","WithDecryption":true}`:
-			val = "BAZ"
-		case `{"Name":"/hoge/fuga/piyo","WithDecryption":true}`:
-			val = "HOGERA"
-		default:
-			assert.Fail("unexpected secret id: " + string(body))
-		}
-
-		return httpmock.NewStringResponse(http.StatusOK, fmt.Sprintf(`{
-			"Parameter": {
-				"ARN":"arn:aws:ssm:us-east-1:123456789012:parameter<name>",
-				"DataType":"text",
-				"LastModifiedDate":0,
-				"Name":"<name>",
-				"Type":"SecureString",
-				"Value":"%s",
-				"Version":1
-			}
-		}`, val)), nil
+		return httpmock.NewStringResponse(http.StatusOK, `{
+			"InvalidParameters": [],
+			"Parameters": [
+				{
+					"ARN":"arn:aws:ssm:us-east-1:123456789012:parameter/foo/bar/zoo",
+					"DataType":"text",
+					"LastModifiedDate":0,
+					"Name":"/foo/bar/zoo",
+					"Type":"SecureString",
+					"Value":"BAZ",
+					"Version":1
+				},
+				{
+					"ARN":"arn:aws:ssm:us-east-1:123456789012:parameter/hoge/fuga/piyo",
+					"DataType":"text",
+					"LastModifiedDate":0,
+					"Name":"/hoge/fuga/piyo",
+					"Type":"SecureString",
+					"Value":"HOGERA",
+					"Version":1
+				}
+			]
+		}`), nil
 	})
 
 	envFrom := map[string]string{
@@ -70,7 +74,7 @@ func Test_loadEnv_PS_OK(t *testing.T) {
 		},
 	}
 
-	value, err := sev.LoadEnv(envFrom, providers)
+	value, err := sev.LoadEnv(envFrom, nil, providers, 1)
 	require.NoError(err)
 	assert.Equal(map[string]string{
 		"FOO":   "BAZ",
@@ -89,28 +93,31 @@ func Test_loadEnv_PS_Without_Prefix(t *testing.T) {
 
 	httpmock.RegisterResponder(http.MethodPost, "https://ssm.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
 		body, _ := io.ReadAll(req.Body)
-		val := ""
+		assert.Equal(`{"Names":["/foo/bar/zoo","/hoge/fuga/piyo"],"WithDecryption":true}`, string(body))
 
-		switch string(body) {
-		case `{"Name":"/foo/bar/zoo","WithDecryption":true}`:
-			val = "BAZ"
-		case `{"Name":"/hoge/fuga/piyo","WithDecryption":true}`:
-			val = "HOGERA"
-		default:
-			assert.Fail("unexpected secret id: " + string(body))
-		}
-
-		return httpmock.NewStringResponse(http.StatusOK, fmt.Sprintf(`{
-			"Parameter": {
-				"ARN":"arn:aws:ssm:us-east-1:123456789012:parameter<name>",
-				"DataType":"text",
-				"LastModifiedDate":0,
-				"Name":"<name>",
-				"Type":"SecureString",
-				"Value":"%s",
-				"Version":1
-			}
-		}`, val)), nil
+		return httpmock.NewStringResponse(http.StatusOK, `{
+			"InvalidParameters": [],
+			"Parameters": [
+				{
+					"ARN":"arn:aws:ssm:us-east-1:123456789012:parameter/foo/bar/zoo",
+					"DataType":"text",
+					"LastModifiedDate":0,
+					"Name":"/foo/bar/zoo",
+					"Type":"SecureString",
+					"Value":"BAZ",
+					"Version":1
+				},
+				{
+					"ARN":"arn:aws:ssm:us-east-1:123456789012:parameter/hoge/fuga/piyo",
+					"DataType":"text",
+					"LastModifiedDate":0,
+					"Name":"/hoge/fuga/piyo",
+					"Type":"SecureString",
+					"Value":"HOGERA",
+					"Version":1
+				}
+			]
+		}`), nil
 	})
 
 	envFrom := map[string]string{
@@ -132,7 +139,7 @@ func Test_loadEnv_PS_Without_Prefix(t *testing.T) {
 		},
 	}
 
-	value, err := sev.LoadEnv(envFrom, providers)
+	value, err := sev.LoadEnv(envFrom, nil, providers, 1)
 	require.NoError(err)
 	assert.Equal(map[string]string{
 		"FOO":   "BAZ",
@@ -174,6 +181,333 @@ func Test_loadEnv_PS_Err(t *testing.T) {
 		},
 	}
 
-	_, err := sev.LoadEnv(envFrom, providers)
+	_, err := sev.LoadEnv(envFrom, nil, providers, 1)
 	assert.ErrorContains(err, "StatusCode: 503")
 }
+
+func Test_loadEnv_PS_OK_Dedup(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://ssm.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		assert.Equal(`{"Names":["/foo/bar/zoo"],"WithDecryption":true}`, string(body))
+
+		return httpmock.NewStringResponse(http.StatusOK, `{
+			"InvalidParameters": [],
+			"Parameters": [
+				{
+					"ARN":"arn:aws:ssm:us-east-1:123456789012:parameter/foo/bar/zoo",
+					"DataType":"text",
+					"LastModifiedDate":0,
+					"Name":"/foo/bar/zoo",
+					"Type":"SecureString",
+					"Value":"BAZ",
+					"Version":1
+				}
+			]
+		}`), nil
+	})
+
+	envFrom := map[string]string{
+		"FOO":  "parameterstore:///foo/bar/zoo",
+		"PIYO": "parameterstore://foo/bar/zoo",
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	providers := &mockProviders{
+		newSSMClient: func() (*ssm.Client, error) {
+			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+			require.NoError(err)
+			svc := ssm.NewFromConfig(cfg)
+			return svc, nil
+		},
+	}
+
+	value, err := sev.LoadEnv(envFrom, nil, providers, 4)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"FOO":  "BAZ",
+		"PIYO": "BAZ",
+	}, value)
+	assert.Equal(1, httpmock.GetTotalCallCount())
+}
+
+func Test_loadEnv_PS_OK_Chunk(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://ssm.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		var input struct{ Names []string }
+		json.Unmarshal(body, &input)
+		assert.LessOrEqual(len(input.Names), 10)
+		params := []map[string]any{}
+
+		for _, name := range input.Names {
+			params = append(params, map[string]any{"Name": name, "Value": "value of " + name})
+		}
+
+		return httpmock.NewJsonResponse(http.StatusOK, map[string]any{"Parameters": params})
+	})
+
+	envFrom := map[string]string{}
+	expected := map[string]string{}
+
+	for i := range 25 {
+		envFrom[fmt.Sprintf("FOO%02d", i)] = fmt.Sprintf("parameterstore:///foo/%02d", i)
+		expected[fmt.Sprintf("FOO%02d", i)] = fmt.Sprintf("value of /foo/%02d", i)
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	providers := &mockProviders{
+		newSSMClient: func() (*ssm.Client, error) {
+			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+			require.NoError(err)
+			svc := ssm.NewFromConfig(cfg)
+			return svc, nil
+		},
+	}
+
+	value, err := sev.LoadEnv(envFrom, nil, providers, 2)
+	require.NoError(err)
+	assert.Equal(expected, value)
+	assert.Equal(3, httpmock.GetTotalCallCount())
+}
+
+func Test_loadEnv_PS_Err_InvalidParameters(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://ssm.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `{
+			"InvalidParameters": ["/hoge/fuga/piyo"],
+			"Parameters": [
+				{
+					"ARN":"arn:aws:ssm:us-east-1:123456789012:parameter/foo/bar/zoo",
+					"DataType":"text",
+					"LastModifiedDate":0,
+					"Name":"/foo/bar/zoo",
+					"Type":"SecureString",
+					"Value":"BAZ",
+					"Version":1
+				}
+			]
+		}`), nil
+	})
+
+	envFrom := map[string]string{
+		"FOO":  "parameterstore:///foo/bar/zoo",
+		"PIYO": "parameterstore:///hoge/fuga/piyo",
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	providers := &mockProviders{
+		newSSMClient: func() (*ssm.Client, error) {
+			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+			require.NoError(err)
+			svc := ssm.NewFromConfig(cfg)
+			return svc, nil
+		},
+	}
+
+	_, err := sev.LoadEnv(envFrom, nil, providers, 1)
+	assert.EqualError(err, "failed to get parameterstore:///hoge/fuga/piyo: invalid parameter: /hoge/fuga/piyo")
+}
+
+func Test_loadEnv_PS_OK_Selector(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://ssm.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		assert.Equal(`{"Names":["/app/token:prod-label","/app/token:3"],"WithDecryption":true}`, string(body))
+
+		return httpmock.NewStringResponse(http.StatusOK, `{
+			"InvalidParameters": [],
+			"Parameters": [
+				{
+					"ARN":"arn:aws:ssm:us-east-1:123456789012:parameter/app/token",
+					"DataType":"text",
+					"LastModifiedDate":0,
+					"Name":"/app/token",
+					"Selector":":3",
+					"Type":"SecureString",
+					"Value":"TOKEN3",
+					"Version":3
+				},
+				{
+					"ARN":"arn:aws:ssm:us-east-1:123456789012:parameter/app/token",
+					"DataType":"text",
+					"LastModifiedDate":0,
+					"Name":"/app/token",
+					"Selector":":prod-label",
+					"Type":"SecureString",
+					"Value":"TOKEN4",
+					"Version":4
+				}
+			]
+		}`), nil
+	})
+
+	envFrom := map[string]string{
+		"TOKEN_V3":   "parameterstore:///app/token:3",
+		"TOKEN_PROD": "parameterstore:///app/token:prod-label",
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	providers := &mockProviders{
+		newSSMClient: func() (*ssm.Client, error) {
+			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+			require.NoError(err)
+			svc := ssm.NewFromConfig(cfg)
+			return svc, nil
+		},
+	}
+
+	value, err := sev.LoadEnv(envFrom, nil, providers, 1)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"TOKEN_V3":   "TOKEN3",
+		"TOKEN_PROD": "TOKEN4",
+	}, value)
+}
+
+func Test_loadEnv_PS_Err_InvalidSelector(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	envFrom := map[string]string{
+		"TOKEN": "parameterstore:///app/token:0",
+	}
+
+	providers := &mockProviders{
+		newSSMClient: func() (*ssm.Client, error) {
+			require.Fail("Must not call newSSMClient")
+			return nil, nil
+		},
+	}
+
+	_, err := sev.LoadEnv(envFrom, nil, providers, 1)
+	assert.EqualError(err, "failed to get parameterstore:///app/token:0: invalid parameter version in '/app/token:0': '0'")
+}
+
+func Test_loadEnv_PS_OK_Path(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://ssm.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+
+		switch req.Header.Get("X-Amz-Target") {
+		case "AmazonSSM.GetParametersByPath":
+			assert.Equal(`{"Path":"/myapp/prod","Recursive":true,"WithDecryption":true}`, string(body))
+
+			return httpmock.NewStringResponse(http.StatusOK, `{
+				"Parameters": [
+					{"Name":"/myapp/prod/db-host","Type":"String","Value":"localhost","Version":1},
+					{"Name":"/myapp/prod/api/token","Type":"SecureString","Value":"TOKEN","Version":1},
+					{"Name":"/myapp/prod/hello","Type":"String","Value":"overridden","Version":1}
+				]
+			}`), nil
+		case "AmazonSSM.GetParameters":
+			assert.Equal(`{"Names":["/myapp/prod/hello"],"WithDecryption":true}`, string(body))
+
+			return httpmock.NewStringResponse(http.StatusOK, `{
+				"InvalidParameters": [],
+				"Parameters": [
+					{"Name":"/myapp/prod/hello","Type":"String","Value":"world","Version":1}
+				]
+			}`), nil
+		default:
+			assert.Fail("unexpected target: " + req.Header.Get("X-Amz-Target"))
+			return nil, nil
+		}
+	})
+
+	envFrom := map[string]string{
+		"*":       "parameterstore:///myapp/prod/?recursive=true",
+		"RAW_*":   "parameterstore:///myapp/prod?recursive=true&strip_prefix=false&uppercase=false&replace_separators=false",
+		"HELLO":   "parameterstore:///myapp/prod/hello",
+		"LITERAL": "literal",
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	providers := &mockProviders{
+		newSSMClient: func() (*ssm.Client, error) {
+			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+			require.NoError(err)
+			svc := ssm.NewFromConfig(cfg)
+			return svc, nil
+		},
+	}
+
+	value, err := sev.LoadEnv(envFrom, nil, providers, 2)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"DB_HOST":                  "localhost",
+		"API_TOKEN":                "TOKEN",
+		"HELLO":                    "world",
+		"RAW_myapp/prod/db-host":   "localhost",
+		"RAW_myapp/prod/api/token": "TOKEN",
+		"RAW_myapp/prod/hello":     "overridden",
+		"LITERAL":                  "literal",
+	}, value)
+	assert.Equal(2, httpmock.GetTotalCallCount())
+}
+
+func Test_loadEnv_PS_Err_Path(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	envFrom := map[string]string{
+		"*":     "parameterstore:///myapp/prod/?recursive=yes",
+		"FOO_*": "foo",
+	}
+
+	providers := &mockProviders{
+		newSSMClient: func() (*ssm.Client, error) {
+			require.Fail("Must not call newSSMClient")
+			return nil, nil
+		},
+	}
+
+	_, err := sev.LoadEnv(envFrom, nil, providers, 1)
+	assert.EqualError(err, `failed to get parameterstore:///myapp/prod/?recursive=yes: invalid value of 'recursive' in '/myapp/prod/?recursive=yes': strconv.ParseBool: parsing "yes": invalid syntax`+"\n"+
+		"failed to get foo: wildcard key requires a secretsmanager://, parameterstore://, vault://, dotenv:// or age:// reference: FOO_*")
+}
@@ -2,14 +2,19 @@ package sev_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/jarcoal/httpmock"
@@ -21,16 +26,21 @@ import (
 type mockProviders struct {
 	newSecretsManagerClient func() (*secretsmanager.Client, error)
 	newSSMClient            func() (*ssm.Client, error)
+	newKMSClient            func() (*kms.Client, error)
 }
 
-func (p *mockProviders) NewSecretsManagerClient() (*secretsmanager.Client, error) {
+func (p *mockProviders) NewSecretsManagerClient(_ sev.AWSTarget) (*secretsmanager.Client, error) {
 	return p.newSecretsManagerClient()
 }
 
-func (p *mockProviders) NewSSMClient() (*ssm.Client, error) {
+func (p *mockProviders) NewSSMClient(_ sev.AWSTarget) (*ssm.Client, error) {
 	return p.newSSMClient()
 }
 
+func (p *mockProviders) NewKMSClient(_ sev.AWSTarget) (*kms.Client, error) {
+	return p.newKMSClient()
+}
+
 func Test_loadEnv_OK(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -41,25 +51,30 @@ func Test_loadEnv_OK(t *testing.T) {
 
 	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
 		body, _ := io.ReadAll(req.Body)
-		val := ""
-
-		switch string(body) {
-		case `{"SecretId":"foo/bar/zoo"}`:
-			val = "BAZ"
-		case `{"SecretId":"hoge/fuga/piyo"}`:
-			val = "HOGERA"
-		default:
-			assert.Fail("unexpected secret id: " + string(body))
-		}
-
-		return httpmock.NewStringResponse(http.StatusOK, fmt.Sprintf(`{
-			"ARN":"arn:aws:secretsmanager:us-east-1:123456789012:secret:<secret-id>",
-			"CreatedDate":0,
-			"Name":"<secret-id>",
-			"SecretString":"%s",
-			"VersionId":"5048d25e-e46f-4a6c-87d9-b358e5c5dfcf",
-			"VersionStages":["AWSCURRENT"]
-		}`, val)), nil
+		assert.Equal("secretsmanager.BatchGetSecretValue", req.Header.Get("X-Amz-Target"))
+		assert.Equal(`{"SecretIdList":["foo/bar/zoo","hoge/fuga/piyo"]}`, string(body))
+
+		return httpmock.NewStringResponse(http.StatusOK, `{
+			"Errors":[],
+			"SecretValues":[
+				{
+					"ARN":"arn:aws:secretsmanager:us-east-1:123456789012:secret:foo/bar/zoo-AbCdEf",
+					"CreatedDate":0,
+					"Name":"foo/bar/zoo",
+					"SecretString":"BAZ",
+					"VersionId":"5048d25e-e46f-4a6c-87d9-b358e5c5dfcf",
+					"VersionStages":["AWSCURRENT"]
+				},
+				{
+					"ARN":"arn:aws:secretsmanager:us-east-1:123456789012:secret:hoge/fuga/piyo-AbCdEf",
+					"CreatedDate":0,
+					"Name":"hoge/fuga/piyo",
+					"SecretString":"HOGERA",
+					"VersionId":"5048d25e-e46f-4a6c-87d9-b358e5c5dfcf",
+					"VersionStages":["AWSCURRENT"]
+				}
+			]
+		}`), nil
 	})
 
 	envFrom := map[string]string{
@@ -81,7 +96,7 @@ func Test_loadEnv_OK(t *testing.T) {
 		},
 	}
 
-	value, err := sev.LoadEnv(envFrom, providers)
+	value, err := sev.LoadEnv(envFrom, nil, providers, 1)
 	require.NoError(err)
 	assert.Equal(map[string]string{
 		"FOO":   "BAZ",
@@ -100,25 +115,30 @@ func Test_loadEnv_OK_JSON(t *testing.T) {
 
 	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
 		body, _ := io.ReadAll(req.Body)
-		val := ""
-
-		switch string(body) {
-		case `{"SecretId":"foo/bar/zoo"}`:
-			val = `{\"FOO\":\"BAR\",\"oof\":\"rab\"}`
-		case `{"SecretId":"hoge/fuga/piyo"}`:
-			val = `{\"FUGA\":\"FUGAFUGA\",\"gafu\":\"gafugafu\"}`
-		default:
-			assert.Fail("unexpected secret id: " + string(body))
-		}
-
-		return httpmock.NewStringResponse(http.StatusOK, fmt.Sprintf(`{
-			"ARN":"arn:aws:secretsmanager:us-east-1:123456789012:secret:<secret-id>",
-			"CreatedDate":0,
-			"Name":"<secret-id>",
-			"SecretString":"%s",
-			"VersionId":"5048d25e-e46f-4a6c-87d9-b358e5c5dfcf",
-			"VersionStages":["AWSCURRENT"]
-		}`, val)), nil
+		assert.Equal("secretsmanager.BatchGetSecretValue", req.Header.Get("X-Amz-Target"))
+		assert.Equal(`{"SecretIdList":["foo/bar/zoo","hoge/fuga/piyo"]}`, string(body))
+
+		return httpmock.NewStringResponse(http.StatusOK, `{
+			"Errors":[],
+			"SecretValues":[
+				{
+					"ARN":"arn:aws:secretsmanager:us-east-1:123456789012:secret:foo/bar/zoo-AbCdEf",
+					"CreatedDate":0,
+					"Name":"foo/bar/zoo",
+					"SecretString":"{\"FOO\":\"BAR\",\"oof\":\"rab\"}",
+					"VersionId":"5048d25e-e46f-4a6c-87d9-b358e5c5dfcf",
+					"VersionStages":["AWSCURRENT"]
+				},
+				{
+					"ARN":"arn:aws:secretsmanager:us-east-1:123456789012:secret:hoge/fuga/piyo-AbCdEf",
+					"CreatedDate":0,
+					"Name":"hoge/fuga/piyo",
+					"SecretString":"{\"FUGA\":\"FUGAFUGA\",\"gafu\":\"gafugafu\"}",
+					"VersionId":"5048d25e-e46f-4a6c-87d9-b358e5c5dfcf",
+					"VersionStages":["AWSCURRENT"]
+				}
+			]
+		}`), nil
 	})
 
 	envFrom := map[string]string{
@@ -140,7 +160,7 @@ func Test_loadEnv_OK_JSON(t *testing.T) {
 		},
 	}
 
-	value, err := sev.LoadEnv(envFrom, providers)
+	value, err := sev.LoadEnv(envFrom, nil, providers, 1)
 	require.NoError(err)
 	assert.Equal(map[string]string{
 		"FOO":   "BAR",
@@ -182,7 +202,7 @@ func Test_loadEnv_Err(t *testing.T) {
 		},
 	}
 
-	_, err := sev.LoadEnv(envFrom, providers)
+	_, err := sev.LoadEnv(envFrom, nil, providers, 1)
 	assert.ErrorContains(err, "StatusCode: 503")
 }
 
@@ -215,7 +235,7 @@ func Test_loadEnv_Err_NotFound(t *testing.T) {
 		},
 	}
 
-	_, err := sev.LoadEnv(envFrom, providers)
+	_, err := sev.LoadEnv(envFrom, nil, providers, 1)
 	assert.ErrorContains(err, `ResourceNotFoundException: Secrets Manager can\'t find the specified secret`)
 }
 
@@ -236,7 +256,7 @@ func Test_loadEnv_Without_AWS(t *testing.T) {
 		},
 	}
 
-	value, err := sev.LoadEnv(envFrom, providers)
+	value, err := sev.LoadEnv(envFrom, nil, providers, 1)
 	require.NoError(err)
 	assert.Equal(map[string]string{
 		"FOO":   "BAR",
@@ -244,3 +264,628 @@ func Test_loadEnv_Without_AWS(t *testing.T) {
 		"HELLO": "world",
 	}, value)
 }
+
+func Test_loadEnv_OK_Concurrency(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	var mu sync.Mutex
+	inFlight := 0
+	maxInFlight := 0
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		body, _ := io.ReadAll(req.Body)
+		var input struct{ SecretIdList []string }
+		json.Unmarshal(body, &input)
+		assert.LessOrEqual(len(input.SecretIdList), 20)
+		values := []map[string]any{}
+
+		for _, secretID := range input.SecretIdList {
+			values = append(values, map[string]any{"Name": secretID, "SecretString": "value of " + secretID})
+		}
+
+		return httpmock.NewJsonResponse(http.StatusOK, map[string]any{"SecretValues": values})
+	})
+
+	envFrom := map[string]string{"HELLO": "world"}
+	expected := map[string]string{"HELLO": "world"}
+
+	for i := range 100 {
+		envFrom[fmt.Sprintf("FOO%02d", i)] = fmt.Sprintf("secretsmanager://foo/%02d", i)
+		expected[fmt.Sprintf("FOO%02d", i)] = fmt.Sprintf("value of foo/%02d", i)
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+	require.NoError(err)
+	svc := secretsmanager.NewFromConfig(cfg)
+
+	providers := &mockProviders{
+		newSecretsManagerClient: func() (*secretsmanager.Client, error) {
+			return svc, nil
+		},
+	}
+
+	value, err := sev.LoadEnv(envFrom, nil, providers, 4)
+	require.NoError(err)
+	assert.Equal(expected, value)
+	assert.LessOrEqual(maxInFlight, 4)
+	assert.Greater(maxInFlight, 1)
+	assert.Equal(5, httpmock.GetTotalCallCount())
+}
+
+func Test_loadEnv_OK_Dedup(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		assert.Equal(`{"SecretIdList":["app/db","app/token"]}`, string(body))
+
+		return httpmock.NewStringResponse(http.StatusOK, `{
+			"Errors":[],
+			"SecretValues":[
+				{
+					"ARN":"arn:aws:secretsmanager:us-east-1:123456789012:secret:app/db-AbCdEf",
+					"CreatedDate":0,
+					"Name":"app/db",
+					"SecretString":"{\"USER\":\"scott\",\"PASSWORD\":\"tiger\"}",
+					"VersionId":"5048d25e-e46f-4a6c-87d9-b358e5c5dfcf",
+					"VersionStages":["AWSCURRENT"]
+				},
+				{
+					"ARN":"arn:aws:secretsmanager:us-east-1:123456789012:secret:app/token-AbCdEf",
+					"CreatedDate":0,
+					"Name":"app/token",
+					"SecretString":"TOKEN",
+					"VersionId":"5048d25e-e46f-4a6c-87d9-b358e5c5dfcf",
+					"VersionStages":["AWSCURRENT"]
+				}
+			]
+		}`), nil
+	})
+
+	envFrom := map[string]string{
+		"DB_USER":     "secretsmanager://app/db:USER",
+		"DB_PASSWORD": "secretsmanager://app/db:PASSWORD",
+		"DB_JSON":     "secretsmanager://app/db",
+		"TOKEN1":      "secretsmanager://app/token",
+		"TOKEN2":      "secretsmanager://app/token",
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	providers := &mockProviders{
+		newSecretsManagerClient: func() (*secretsmanager.Client, error) {
+			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+			require.NoError(err)
+			svc := secretsmanager.NewFromConfig(cfg)
+			return svc, nil
+		},
+	}
+
+	value, err := sev.LoadEnv(envFrom, nil, providers, 4)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"DB_USER":     "scott",
+		"DB_PASSWORD": "tiger",
+		"DB_JSON":     `{"USER":"scott","PASSWORD":"tiger"}`,
+		"TOKEN1":      "TOKEN",
+		"TOKEN2":      "TOKEN",
+	}, value)
+	assert.Equal(1, httpmock.GetTotalCallCount())
+}
+
+func Test_loadEnv_OK_BatchAccessDenied(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("X-Amz-Target") == "secretsmanager.BatchGetSecretValue" {
+			return httpmock.NewStringResponse(http.StatusBadRequest, `{"__type":"AccessDeniedException","Message":"not authorized to perform: secretsmanager:BatchGetSecretValue"}`), nil
+		}
+
+		body, _ := io.ReadAll(req.Body)
+		val := ""
+
+		switch string(body) {
+		case `{"SecretId":"foo/bar/zoo"}`:
+			val = "BAZ"
+		case `{"SecretId":"hoge/fuga/piyo"}`:
+			val = "HOGERA"
+		default:
+			assert.Fail("unexpected secret id: " + string(body))
+		}
+
+		return httpmock.NewStringResponse(http.StatusOK, fmt.Sprintf(`{
+			"ARN":"arn:aws:secretsmanager:us-east-1:123456789012:secret:<secret-id>",
+			"CreatedDate":0,
+			"Name":"<secret-id>",
+			"SecretString":"%s",
+			"VersionId":"5048d25e-e46f-4a6c-87d9-b358e5c5dfcf",
+			"VersionStages":["AWSCURRENT"]
+		}`, val)), nil
+	})
+
+	envFrom := map[string]string{
+		"FOO":  "secretsmanager://foo/bar/zoo",
+		"PIYO": "secretsmanager://hoge/fuga/piyo",
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	providers := &mockProviders{
+		newSecretsManagerClient: func() (*secretsmanager.Client, error) {
+			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+			require.NoError(err)
+			svc := secretsmanager.NewFromConfig(cfg)
+			return svc, nil
+		},
+	}
+
+	value, err := sev.LoadEnv(envFrom, nil, providers, 1)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"FOO":  "BAZ",
+		"PIYO": "HOGERA",
+	}, value)
+	assert.Equal(3, httpmock.GetTotalCallCount())
+}
+
+func Test_loadEnv_Err_BatchErrors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `{
+			"Errors":[
+				{
+					"ErrorCode":"ResourceNotFoundException",
+					"Message":"Secrets Manager can't find the specified secret.",
+					"SecretId":"hoge/fuga/piyo"
+				}
+			],
+			"SecretValues":[
+				{
+					"ARN":"arn:aws:secretsmanager:us-east-1:123456789012:secret:foo/bar/zoo-AbCdEf",
+					"CreatedDate":0,
+					"Name":"foo/bar/zoo",
+					"SecretString":"BAZ",
+					"VersionId":"5048d25e-e46f-4a6c-87d9-b358e5c5dfcf",
+					"VersionStages":["AWSCURRENT"]
+				}
+			]
+		}`), nil
+	})
+
+	envFrom := map[string]string{
+		"FOO":  "secretsmanager://foo/bar/zoo",
+		"PIYO": "secretsmanager://hoge/fuga/piyo",
+		"HOGE": "secretsmanager://hoge/fuga/piyo:HOGE",
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	providers := &mockProviders{
+		newSecretsManagerClient: func() (*secretsmanager.Client, error) {
+			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+			require.NoError(err)
+			svc := secretsmanager.NewFromConfig(cfg)
+			return svc, nil
+		},
+	}
+
+	_, err := sev.LoadEnv(envFrom, nil, providers, 1)
+	assert.EqualError(err, "failed to get secretsmanager://hoge/fuga/piyo:HOGE: ResourceNotFoundException: Secrets Manager can't find the specified secret.\n"+
+		"failed to get secretsmanager://hoge/fuga/piyo: ResourceNotFoundException: Secrets Manager can't find the specified secret.")
+}
+
+func Test_loadEnv_OK_VersionStage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		assert.Equal("secretsmanager.GetSecretValue", req.Header.Get("X-Amz-Target"))
+		body, _ := io.ReadAll(req.Body)
+		val := ""
+
+		switch string(body) {
+		case `{"SecretId":"app/db","VersionStage":"AWSCURRENT"}`:
+			val = `{\"USER\":\"scott\",\"PASSWORD\":\"tiger\"}`
+		case `{"SecretId":"app/db","VersionStage":"AWSPENDING"}`:
+			val = `{\"USER\":\"scott\",\"PASSWORD\":\"lion\"}`
+		default:
+			assert.Fail("unexpected secret id: " + string(body))
+		}
+
+		return httpmock.NewStringResponse(http.StatusOK, fmt.Sprintf(`{
+			"ARN":"arn:aws:secretsmanager:us-east-1:123456789012:secret:<secret-id>",
+			"CreatedDate":0,
+			"Name":"<secret-id>",
+			"SecretString":"%s",
+			"VersionId":"5048d25e-e46f-4a6c-87d9-b358e5c5dfcf",
+			"VersionStages":["AWSCURRENT"]
+		}`, val)), nil
+	})
+
+	envFrom := map[string]string{
+		"USER":         "secretsmanager://app/db:USER?stage=AWSCURRENT",
+		"PASSWORD":     "secretsmanager://app/db:PASSWORD?stage=AWSCURRENT",
+		"NEW_PASSWORD": "secretsmanager://app/db:PASSWORD?stage=AWSPENDING",
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	providers := &mockProviders{
+		newSecretsManagerClient: func() (*secretsmanager.Client, error) {
+			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+			require.NoError(err)
+			svc := secretsmanager.NewFromConfig(cfg)
+			return svc, nil
+		},
+	}
+
+	value, err := sev.LoadEnv(envFrom, nil, providers, 1)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"USER":         "scott",
+		"PASSWORD":     "tiger",
+		"NEW_PASSWORD": "lion",
+	}, value)
+	assert.Equal(2, httpmock.GetTotalCallCount())
+}
+
+func Test_loadEnv_Err_InvalidSecretRef(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	envFrom := map[string]string{
+		"FOO": "secretsmanager://foo/bar/zoo?stage=AWSPENDING&label=prod",
+		"BAR": "secretsmanager://:KEY",
+	}
+
+	providers := &mockProviders{
+		newSecretsManagerClient: func() (*secretsmanager.Client, error) {
+			require.Fail("Must not call newSecretsManagerClient")
+			return nil, nil
+		},
+	}
+
+	_, err := sev.LoadEnv(envFrom, nil, providers, 1)
+	assert.EqualError(err, "failed to get secretsmanager://:KEY: secret ID is empty: ':KEY'\n"+
+		"failed to get secretsmanager://foo/bar/zoo?stage=AWSPENDING&label=prod: unknown query parameter in 'foo/bar/zoo?stage=AWSPENDING&label=prod': 'label'")
+}
+
+func Test_loadEnv_Err_WithFiles(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	envFrom := map[string]string{
+		"FOO": "secretsmanager://foo/bar/zoo?label=prod",
+		"BAR": "secretsmanager://:KEY",
+	}
+
+	files := map[string]string{
+		"FOO": "/home/me/.sev.toml",
+	}
+
+	providers := &mockProviders{
+		newSecretsManagerClient: func() (*secretsmanager.Client, error) {
+			require.Fail("Must not call newSecretsManagerClient")
+			return nil, nil
+		},
+	}
+
+	_, err := sev.LoadEnv(envFrom, files, providers, 1)
+	assert.EqualError(err, "failed to get secretsmanager://:KEY: secret ID is empty: ':KEY'\n"+
+		"failed to get secretsmanager://foo/bar/zoo?label=prod (FOO in /home/me/.sev.toml): unknown query parameter in 'foo/bar/zoo?label=prod': 'label'")
+}
+
+func Test_loadEnv_OK_Spread(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		assert.Equal(`{"SecretId":"app/db"}`, string(body))
+
+		return httpmock.NewStringResponse(http.StatusOK, `{
+			"ARN":"arn:aws:secretsmanager:us-east-1:123456789012:secret:app/db-AbCdEf",
+			"CreatedDate":0,
+			"Name":"app/db",
+			"SecretString":"{\"USER\":\"scott\",\"PASSWORD\":\"tiger\",\"HOST\":\"localhost\"}",
+			"VersionId":"5048d25e-e46f-4a6c-87d9-b358e5c5dfcf",
+			"VersionStages":["AWSCURRENT"]
+		}`), nil
+	})
+
+	envFrom := map[string]string{
+		"*":      "secretsmanager://app/db?exclude=PASSWORD",
+		"DB_*":   "secretsmanager://app/db?include=USER,PASSWORD",
+		"HOST":   "127.0.0.1",
+		"DB_USE": "secretsmanager://app/db:USER",
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	providers := &mockProviders{
+		newSecretsManagerClient: func() (*secretsmanager.Client, error) {
+			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+			require.NoError(err)
+			svc := secretsmanager.NewFromConfig(cfg)
+			return svc, nil
+		},
+	}
+
+	value, err := sev.LoadEnv(envFrom, nil, providers, 1)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"USER":        "scott",
+		"HOST":        "127.0.0.1",
+		"DB_USER":     "scott",
+		"DB_PASSWORD": "tiger",
+		"DB_USE":      "scott",
+	}, value)
+	assert.Equal(1, httpmock.GetTotalCallCount())
+}
+
+func Test_loadEnv_Err_Spread(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `{
+			"ARN":"arn:aws:secretsmanager:us-east-1:123456789012:secret:app/db-AbCdEf",
+			"CreatedDate":0,
+			"Name":"app/db",
+			"SecretString":"{\"USER\":\"scott\",\"PASSWORD\":\"tiger\"}",
+			"VersionId":"5048d25e-e46f-4a6c-87d9-b358e5c5dfcf",
+			"VersionStages":["AWSCURRENT"]
+		}`), nil
+	})
+
+	envFrom := map[string]string{
+		"A_*": "secretsmanager://app/db:USER",
+		"B_*": "secretsmanager://app/db?include=HOST",
+		"C":   "secretsmanager://app/db?exclude=USER",
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	providers := &mockProviders{
+		newSecretsManagerClient: func() (*secretsmanager.Client, error) {
+			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+			require.NoError(err)
+			svc := secretsmanager.NewFromConfig(cfg)
+			return svc, nil
+		},
+	}
+
+	_, err := sev.LoadEnv(envFrom, nil, providers, 1)
+	assert.EqualError(err, "failed to get secretsmanager://app/db:USER: wildcard key cannot select a JSON key: 'USER'\n"+
+		"failed to get secretsmanager://app/db?include=HOST: key could not be found in 'app/db': 'HOST'\n"+
+		"failed to get secretsmanager://app/db?exclude=USER: include/exclude requires a wildcard key")
+}
+
+func Test_loadEnv_OK_Binary(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `{
+			"ARN":"arn:aws:secretsmanager:us-east-1:123456789012:secret:app/cert-AbCdEf",
+			"CreatedDate":0,
+			"Name":"app/cert",
+			"SecretBinary":"AP8BAg==",
+			"VersionId":"5048d25e-e46f-4a6c-87d9-b358e5c5dfcf",
+			"VersionStages":["AWSCURRENT"]
+		}`), nil
+	})
+
+	envFrom := map[string]string{
+		"CERT":      "secretsmanager://app/cert",
+		"CERT_FILE": "secretsmanager://app/cert?binary=file",
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+	t.Setenv("TMPDIR", t.TempDir())
+
+	providers := &mockProviders{
+		newSecretsManagerClient: func() (*secretsmanager.Client, error) {
+			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+			require.NoError(err)
+			svc := secretsmanager.NewFromConfig(cfg)
+			return svc, nil
+		},
+	}
+
+	value, err := sev.LoadEnv(envFrom, nil, providers, 1)
+	require.NoError(err)
+	assert.Equal("AP8BAg==", value["CERT"])
+	data, err := os.ReadFile(value["CERT_FILE"])
+	require.NoError(err)
+	assert.Equal([]byte{0x00, 0xff, 0x01, 0x02}, data)
+	info, err := os.Stat(value["CERT_FILE"])
+	require.NoError(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+}
+
+func Test_loadEnv_Err_Binary(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `{
+			"ARN":"arn:aws:secretsmanager:us-east-1:123456789012:secret:app/cert-AbCdEf",
+			"CreatedDate":0,
+			"Name":"app/cert",
+			"SecretBinary":"AP8BAg==",
+			"VersionId":"5048d25e-e46f-4a6c-87d9-b358e5c5dfcf",
+			"VersionStages":["AWSCURRENT"]
+		}`), nil
+	})
+
+	envFrom := map[string]string{
+		"CERT":   "secretsmanager://app/cert:KEY",
+		"CERT_*": "secretsmanager://app/cert",
+		"RAW":    "secretsmanager://app/cert?binary=raw",
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	providers := &mockProviders{
+		newSecretsManagerClient: func() (*secretsmanager.Client, error) {
+			cfg, err := config.LoadDefaultConfig(context.Background(), config.WithHTTPClient(hc))
+			require.NoError(err)
+			svc := secretsmanager.NewFromConfig(cfg)
+			return svc, nil
+		},
+	}
+
+	_, err := sev.LoadEnv(envFrom, nil, providers, 1)
+	assert.EqualError(err, "failed to get secretsmanager://app/cert: cannot expand binary secret 'app/cert'\n"+
+		"failed to get secretsmanager://app/cert:KEY: cannot select a JSON key from binary secret 'app/cert': 'KEY'\n"+
+		"failed to get secretsmanager://app/cert?binary=raw: invalid value of 'binary' in 'app/cert?binary=raw': 'raw'")
+}
+
+func Test_loadEnv_OK_Targets(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		assert.Equal(`{"SecretIdList":["foo/bar/zoo","hoge/fuga/piyo"]}`, string(body))
+
+		return httpmock.NewStringResponse(http.StatusOK, `{
+			"Errors":[],
+			"SecretValues":[
+				{"Name":"foo/bar/zoo","SecretString":"BAZ"},
+				{"Name":"hoge/fuga/piyo","SecretString":"HOGERA"}
+			]
+		}`), nil
+	})
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.ap-northeast-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		assert.Equal(`{"SecretIdList":["arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:foo/bar/zoo-AbCdEf","hoge/fuga/piyo"]}`, string(body))
+
+		return httpmock.NewStringResponse(http.StatusOK, `{
+			"Errors":[],
+			"SecretValues":[
+				{
+					"ARN":"arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:foo/bar/zoo-AbCdEf",
+					"Name":"foo/bar/zoo",
+					"SecretString":"{\"KEY\":\"TOKYO\"}"
+				},
+				{
+					"ARN":"arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:hoge/fuga/piyo-AbCdEf",
+					"Name":"hoge/fuga/piyo",
+					"SecretString":"HOGERA-TOKYO"
+				}
+			]
+		}`), nil
+	})
+
+	httpmock.RegisterResponder(http.MethodPost, "https://ssm.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `{"InvalidParameters":[],"Parameters":[{"Name":"/foo/bar","Value":"VIRGINIA"}]}`), nil
+	})
+
+	httpmock.RegisterResponder(http.MethodPost, "https://ssm.eu-west-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `{"InvalidParameters":[],"Parameters":[{"Name":"/foo/bar","Value":"IRELAND"}]}`), nil
+	})
+
+	envFrom := map[string]string{
+		"A": "secretsmanager://foo/bar/zoo",
+		"B": "secretsmanager://hoge/fuga/piyo",
+		"C": "secretsmanager://arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:foo/bar/zoo-AbCdEf:KEY",
+		"D": "secretsmanager://hoge/fuga/piyo?region=ap-northeast-1",
+		"E": "parameterstore://foo/bar",
+		"F": "parameterstore://foo/bar?region=eu-west-1",
+	}
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	providers := sev.NewProviders(sev.AWSConfigOptFns{config.WithHTTPClient(hc)}, nil)
+	value, err := sev.LoadEnv(envFrom, nil, providers, 1)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"A": "BAZ",
+		"B": "HOGERA",
+		"C": "TOKYO",
+		"D": "HOGERA-TOKYO",
+		"E": "VIRGINIA",
+		"F": "IRELAND",
+	}, value)
+}
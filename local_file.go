@@ -0,0 +1,160 @@
+package sev
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	PrefixFile   = "file://"
+	PrefixDotenv = "dotenv://"
+)
+
+// localPath expands "~" and resolves a relative path against the directory of the config file that referenced it.
+func localPath(ref *Reference, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("file path is empty: '%s'", ref.URI)
+	}
+
+	path = expandHome(path)
+
+	if !filepath.IsAbs(path) && ref.File != "" {
+		path = filepath.Join(filepath.Dir(ref.File), path)
+	}
+
+	return path, nil
+}
+
+// fileProvider resolves "file://" references to the content of a file, e.g. a Docker or Kubernetes secret:
+//
+//	<path>[?trim=<bool>]
+//
+// With "trim=true", trailing newlines are removed.
+type fileProvider struct{}
+
+func (p *fileProvider) Scheme() string {
+	return strings.TrimSuffix(PrefixFile, "://")
+}
+
+func (p *fileProvider) Resolve(_ context.Context, ref *Reference) (string, error) {
+	path, rawQuery, _ := strings.Cut(ref.Path(), "?")
+	query, err := url.ParseQuery(rawQuery)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to parse query of '%s': %w", ref.Path(), err)
+	}
+
+	trim := false
+
+	for name := range query {
+		if name != "trim" {
+			return "", fmt.Errorf("unknown query parameter in '%s': '%s'", ref.Path(), name)
+		}
+
+		trim, err = strconv.ParseBool(query.Get(name))
+
+		if err != nil {
+			return "", fmt.Errorf("invalid value of '%s' in '%s': %w", name, ref.Path(), err)
+		}
+	}
+
+	path, err = localPath(ref, path)
+
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	if trim {
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	return string(data), nil
+}
+
+// dotenvProvider resolves "dotenv://" references to a variable in a dotenv file:
+//
+//	<path>#<name>
+//
+// A wildcard key imports every variable in the file.
+type dotenvProvider struct{}
+
+func (p *dotenvProvider) Scheme() string {
+	return strings.TrimSuffix(PrefixDotenv, "://")
+}
+
+func (p *dotenvProvider) Resolve(_ context.Context, ref *Reference) (string, error) {
+	path, name, _ := strings.Cut(ref.Path(), "#")
+
+	if name == "" {
+		return "", fmt.Errorf("variable name is empty: '%s'", ref.Path())
+	}
+
+	env, err := p.read(ref, path)
+
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := env[name]
+
+	if !ok {
+		return "", fmt.Errorf("variable could not be found in '%s': '%s'", path, name)
+	}
+
+	return value, nil
+}
+
+func (p *dotenvProvider) Expand(_ context.Context, ref *Reference) (map[string]string, error) {
+	path, name, _ := strings.Cut(ref.Path(), "#")
+
+	if name != "" {
+		return nil, fmt.Errorf("wildcard key cannot select a variable: '%s'", name)
+	}
+
+	values, err := p.read(ref, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	env := map[string]string{}
+
+	for name, value := range values {
+		env[strings.Replace(ref.Name, "*", name, 1)] = value
+	}
+
+	return env, nil
+}
+
+func (p *dotenvProvider) read(ref *Reference, path string) (map[string]string, error) {
+	path, err := localPath(ref, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := parseDotenv(string(data))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return env, nil
+}
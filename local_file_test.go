@@ -0,0 +1,211 @@
+package sev_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/winebarrel/sev"
+)
+
+func Test_loadEnv_File(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "db_password"), []byte("p@ss\n\n"), 0600)
+	require.NoError(err)
+	err = os.MkdirAll(filepath.Join(dir, "secrets"), 0700)
+	require.NoError(err)
+	err = os.WriteFile(filepath.Join(dir, "secrets", "token"), []byte("TOKEN\n"), 0600)
+	require.NoError(err)
+
+	envFrom := map[string]string{
+		"RAW":      "file://" + filepath.Join(dir, "db_password"),
+		"TRIMMED":  "file://" + filepath.Join(dir, "db_password") + "?trim=true",
+		"RELATIVE": "file://secrets/token?trim=true",
+	}
+
+	files := map[string]string{
+		"RELATIVE": filepath.Join(dir, ".sev.toml"),
+	}
+
+	env, err := sev.LoadEnv(envFrom, files, sev.NewProviders(nil, nil), 4)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"RAW":      "p@ss\n\n",
+		"TRIMMED":  "p@ss",
+		"RELATIVE": "TOKEN",
+	}, env)
+}
+
+func Test_loadEnv_File_Home(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	err := os.WriteFile(filepath.Join(home, "token"), []byte("TOKEN"), 0600)
+	require.NoError(err)
+
+	env, err := sev.LoadEnv(map[string]string{"TOKEN": "file://~/token"}, nil, sev.NewProviders(nil, nil), 4)
+	require.NoError(err)
+	assert.Equal(map[string]string{"TOKEN": "TOKEN"}, env)
+}
+
+func Test_loadEnv_File_Err(t *testing.T) {
+	tt := []struct {
+		from string
+		err  string
+	}{
+		{from: "file://", err: "failed to get file://: file path is empty: 'file://'"},
+		{from: "file:///etc/passwd?label=prod", err: "failed to get file:///etc/passwd?label=prod: unknown query parameter in '/etc/passwd?label=prod': 'label'"},
+		{from: "file:///etc/passwd?trim=yes", err: `failed to get file:///etc/passwd?trim=yes: invalid value of 'trim' in '/etc/passwd?trim=yes': strconv.ParseBool: parsing "yes": invalid syntax`},
+	}
+
+	for _, t1 := range tt {
+		t.Run(t1.from, func(t *testing.T) {
+			_, err := sev.LoadEnv(map[string]string{"FOO": t1.from}, nil, sev.NewProviders(nil, nil), 4)
+			assert.EqualError(t, err, t1.err)
+		})
+	}
+}
+
+func Test_loadEnv_Dotenv(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, ".env"), []byte("DB_USER=admin\nDB_PASSWORD=\"p@ss\\n\"\n"), 0600)
+	require.NoError(err)
+
+	envFrom := map[string]string{
+		"USER":    "dotenv://.env#DB_USER",
+		"LOCAL_*": "dotenv://.env",
+	}
+
+	files := map[string]string{
+		"USER":    filepath.Join(dir, ".sev.toml"),
+		"LOCAL_*": filepath.Join(dir, ".sev.toml"),
+	}
+
+	env, err := sev.LoadEnv(envFrom, files, sev.NewProviders(nil, nil), 4)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"USER":              "admin",
+		"LOCAL_DB_USER":     "admin",
+		"LOCAL_DB_PASSWORD": "p@ss\n",
+	}, env)
+}
+
+func Test_loadEnv_Dotenv_Err(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".env")
+	err := os.WriteFile(path, []byte("DB_USER=admin\n"), 0600)
+	require.NoError(t, err)
+
+	tt := []struct {
+		name string
+		from string
+		err  string
+	}{
+		{name: "FOO", from: "dotenv://" + path, err: "failed to get dotenv://" + path + ": variable name is empty: '" + path + "'"},
+		{name: "FOO", from: "dotenv://" + path + "#DB_PASSWORD", err: "failed to get dotenv://" + path + "#DB_PASSWORD: variable could not be found in '" + path + "': 'DB_PASSWORD'"},
+		{name: "FOO_*", from: "dotenv://" + path + "#DB_USER", err: "failed to get dotenv://" + path + "#DB_USER: wildcard key cannot select a variable: 'DB_USER'"},
+	}
+
+	for _, t1 := range tt {
+		t.Run(t1.from, func(t *testing.T) {
+			_, err := sev.LoadEnv(map[string]string{t1.name: t1.from}, nil, sev.NewProviders(nil, nil), 4)
+			assert.EqualError(t, err, t1.err)
+		})
+	}
+}
+
+func Test_parseDotenv(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	env, err := sev.ParseDotenv(`# comment
+export FOO=bar
+BAR = baz # inline comment
+EMPTY=
+SINGLE='$HOME \n # not a comment'
+DOUBLE="say \"hi\"\n\\ \$HOME"
+MULTI="line1
+line2"
+`)
+
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"FOO":    "bar",
+		"BAR":    "baz",
+		"EMPTY":  "",
+		"SINGLE": `$HOME \n # not a comment`,
+		"DOUBLE": "say \"hi\"\n\\ $HOME",
+		"MULTI":  "line1\nline2",
+	}, env)
+}
+
+func Test_parseDotenv_FormatEnv(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	orig := map[string]string{
+		"FOO": "bar",
+		"BAR": "a \"quoted\" $value\\\nwith\r\nnewlines",
+	}
+
+	out, err := sev.FormatEnv(orig, "dotenv")
+	require.NoError(err)
+	env, err := sev.ParseDotenv(out)
+	require.NoError(err)
+	assert.Equal(orig, env)
+}
+
+func Test_parseDotenv_Err(t *testing.T) {
+	tt := []struct {
+		data string
+		err  string
+	}{
+		{data: "FOO", err: "invalid line 1 in dotenv"},
+		{data: "\n1FOO=bar", err: "invalid line 2 in dotenv"},
+		{data: `FOO="bar`, err: "invalid value of FOO at line 1 in dotenv: unclosed quote"},
+		{data: `FOO='bar`, err: "invalid value of FOO at line 1 in dotenv: unclosed quote"},
+	}
+
+	for _, t1 := range tt {
+		t.Run(t1.data, func(t *testing.T) {
+			_, err := sev.ParseDotenv(t1.data)
+			assert.EqualError(t, err, t1.err)
+		})
+	}
+}
+
+func Test_loadEnv_Literal(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	envFrom := map[string]string{
+		"DB_URL":   "literal://file:///tmp/app.db",
+		"LITERAL":  "literal://literal://foo",
+		"HOMEPAGE": "https://example.com",
+	}
+
+	env, err := sev.LoadEnv(envFrom, nil, sev.NewProviders(nil, nil), 4)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"DB_URL":   "file:///tmp/app.db",
+		"LITERAL":  "literal://foo",
+		"HOMEPAGE": "https://example.com",
+	}, env)
+
+	out, err := sev.DryRun(map[string]string{"DB_URL": "literal://file:///tmp/app.db"}, nil, sev.NewProviders(nil, nil), true)
+	require.NoError(err)
+	assert.Equal(`NAME    FILE  SOURCE   VALUE                 STATUS
+DB_URL  -     literal  "file:///tmp/app.db"  ok
+`, out)
+}
@@ -3,25 +3,47 @@ package sev
 import (
 	"os"
 	"strings"
+	"time"
 )
 
-type Options struct {
+type ProfileOptions struct {
 	ConfigGlob         string          `required:"" default:"~/.sev.toml" env:"SEV_CONFIG" help:"Config file path glob pattern."`
 	Profile            string          `arg:"" required:"" help:"Profile name."`
-	Command            []string        `arg:"" required:"" help:"Command and arguments."`
 	DefaultProfile     string          `env:"SEV_DEFAULT_PROFILE" help:"Fallback profile name."`
 	OverrideAwsProfile bool            `negatable:"" default:"true" help:"Use AWS_PROFILE in sev config (enabled by default)."`
+	Concurrency        int             `default:"8" env:"SEV_CONCURRENCY" help:"Maximum number of concurrent secret lookups."`
+	AllowCmd           []string        `env:"SEV_ALLOW_CMD" help:"Commands that cmd:// references may run (comma-separated)."`
+	CmdTimeout         time.Duration   `default:"30s" env:"SEV_CMD_TIMEOUT" help:"Timeout of a cmd:// command."`
 	AWSConfigOptFns    AWSConfigOptFns `kong:"-"`
 }
 
-func (options *Options) AfterApply() error {
-	if strings.HasPrefix(options.ConfigGlob, "~/") {
+func (options *ProfileOptions) AfterApply() error {
+	options.ConfigGlob = expandHome(options.ConfigGlob)
+	return nil
+}
+
+// expandHome replaces a leading "~/" with the home directory, and leaves path as is if it is unknown.
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
 		home, err := os.UserHomeDir()
 
 		if err == nil {
-			options.ConfigGlob = strings.Replace(options.ConfigGlob, "~", home, 1)
+			return strings.Replace(path, "~", home, 1)
 		}
 	}
 
-	return nil
+	return path
+}
+
+type Options struct {
+	ProfileOptions
+	Command []string `arg:"" required:"" help:"Command and arguments."`
+	Exec    bool     `negatable:"" default:"true" help:"Replace the sev process with the command (enabled by default, Unix only)."`
+	DryRun  bool     `help:"Print the variables and their sources, and check that each source is reachable, without running the command."`
+	Reveal  bool     `help:"Show values in --dry-run output instead of masking them."`
+}
+
+type ExportOptions struct {
+	ProfileOptions
+	Format string `short:"f" enum:"bash,zsh,fish,powershell,dotenv,json" default:"bash" help:"Output format (${enum})."`
 }
@@ -0,0 +1,298 @@
+package sev
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+var reParameterLabel = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,100}$`)
+
+// parameterRef is a parsed "parameterstore://" reference:
+//
+//	<name>[:<version>|:<label>][?region=<region>&aws_profile=<profile>]
+//
+// The name may be an ARN, whose region selects the client unless "region" is given.
+type parameterRef struct {
+	name   string
+	target AWSTarget
+}
+
+// parseParameterRef normalizes a "parameterstore://" reference into a GetParameters name and its target.
+func parseParameterRef(from string) (*parameterRef, error) {
+	from, rawQuery, _ := strings.Cut(from, "?")
+	query, err := url.ParseQuery(rawQuery)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query of '%s': %w", from, err)
+	}
+
+	ref := &parameterRef{}
+
+	for name := range query {
+		if !ref.target.setQuery(name, query.Get(name)) {
+			return nil, fmt.Errorf("unknown query parameter in '%s': '%s'", from, name)
+		}
+	}
+
+	var selector string
+	var hasSelector bool
+
+	if strings.HasPrefix(from, "arn:") {
+		// arn:<partition>:ssm:<region>:<account>:parameter/<name>[:<selector>]
+		parts := strings.SplitN(from, ":", 7)
+
+		if len(parts) == 7 {
+			selector, hasSelector = parts[6], true
+		}
+
+		if ref.target.Region == "" {
+			ref.target.Region = regionFromARN(from)
+		}
+	} else {
+		if !strings.HasPrefix(from, "/") {
+			from = "/" + from
+		}
+
+		var name string
+		name, selector, hasSelector = strings.Cut(from, ":")
+
+		if name == "/" {
+			return nil, fmt.Errorf("parameter name is empty: '%s'", from)
+		}
+	}
+
+	ref.name = from
+
+	if !hasSelector {
+		return ref, nil
+	}
+
+	if selector == "" {
+		return nil, fmt.Errorf("selector is empty: '%s'", from)
+	}
+
+	if version, err := strconv.ParseInt(selector, 10, 64); err == nil {
+		if version < 1 {
+			return nil, fmt.Errorf("invalid parameter version in '%s': '%s'", from, selector)
+		}
+
+		return ref, nil
+	}
+
+	lowerSelector := strings.ToLower(selector)
+
+	if !reParameterLabel.MatchString(selector) ||
+		(selector[0] >= '0' && selector[0] <= '9') ||
+		strings.HasPrefix(lowerSelector, "aws") ||
+		strings.HasPrefix(lowerSelector, "ssm") {
+		return nil, fmt.Errorf("invalid parameter label in '%s': '%s'", from, selector)
+	}
+
+	return ref, nil
+}
+
+// key identifies one fetch: the name plus the target.
+func (ref *parameterRef) key() string {
+	query := url.Values{}
+	ref.target.encode(query)
+
+	if len(query) == 0 {
+		return ref.name
+	}
+
+	return ref.name + "?" + query.Encode()
+}
+
+type SSMGetParametersAPI interface {
+	GetParameters(ctx context.Context, params *ssm.GetParametersInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersOutput, error)
+}
+
+func getParameters(ctx context.Context, api SSMGetParametersAPI, names []string) (map[string]string, []string, error) {
+	input := &ssm.GetParametersInput{
+		Names:          names,
+		WithDecryption: aws.Bool(true),
+	}
+
+	output, err := api.GetParameters(ctx, input)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := map[string]string{}
+
+	for _, param := range output.Parameters {
+		values[aws.ToString(param.Name)+aws.ToString(param.Selector)] = aws.ToString(param.Value)
+
+		// A parameter requested by ARN is looked up by its ARN.
+		if param.ARN != nil {
+			values[aws.ToString(param.ARN)+aws.ToString(param.Selector)] = aws.ToString(param.Value)
+		}
+	}
+
+	return values, output.InvalidParameters, nil
+}
+
+type SSMGetParameterAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+func getParameter(api SSMGetParameterAPI, from string) (string, error) {
+	input := &ssm.GetParameterInput{
+		Name:           aws.String(from),
+		WithDecryption: aws.Bool(true),
+	}
+
+	output, err := api.GetParameter(context.Background(), input)
+
+	if err != nil {
+		return "", err
+	}
+
+	value := aws.ToString(output.Parameter.Value)
+	return value, nil
+}
+
+// checkParameter checks that the parameter exists without decrypting the value.
+func checkParameter(api SSMGetParameterAPI, from string) error {
+	input := &ssm.GetParameterInput{
+		Name:           aws.String(from),
+		WithDecryption: aws.Bool(false),
+	}
+
+	_, err := api.GetParameter(context.Background(), input)
+	return err
+}
+
+// parameterPathRef is a "parameterstore://" reference assigned to a wildcard key:
+//
+//	<path>[?recursive=<bool>&strip_prefix=<bool>&uppercase=<bool>&replace_separators=<bool>]
+//
+// "region" and "aws_profile" read the path from another region or account.
+type parameterPathRef struct {
+	path              string
+	recursive         bool
+	stripPrefix       bool
+	uppercase         bool
+	replaceSeparators bool
+	target            AWSTarget
+}
+
+func parseParameterPathRef(from string) (*parameterPathRef, error) {
+	path, rawQuery, _ := strings.Cut(from, "?")
+	query, err := url.ParseQuery(rawQuery)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query of '%s': %w", from, err)
+	}
+
+	path = "/" + strings.Trim(path, "/")
+
+	ref := &parameterPathRef{
+		path:              path,
+		stripPrefix:       true,
+		uppercase:         true,
+		replaceSeparators: true,
+	}
+
+	for name := range query {
+		if ref.target.setQuery(name, query.Get(name)) {
+			continue
+		}
+
+		var opt *bool
+
+		switch name {
+		case "recursive":
+			opt = &ref.recursive
+		case "strip_prefix":
+			opt = &ref.stripPrefix
+		case "uppercase":
+			opt = &ref.uppercase
+		case "replace_separators":
+			opt = &ref.replaceSeparators
+		default:
+			return nil, fmt.Errorf("unknown query parameter in '%s': '%s'", from, name)
+		}
+
+		*opt, err = strconv.ParseBool(query.Get(name))
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of '%s' in '%s': %w", name, from, err)
+		}
+	}
+
+	return ref, nil
+}
+
+// key identifies one fetch: the path plus the recursive flag and the target, without the name mangling options.
+func (ref *parameterPathRef) key() string {
+	query := url.Values{}
+	ref.target.encode(query)
+
+	if ref.recursive {
+		query.Set("recursive", "true")
+	}
+
+	if len(query) == 0 {
+		return ref.path
+	}
+
+	return ref.path + "?" + query.Encode()
+}
+
+func (ref *parameterPathRef) envName(pattern string, paramName string) string {
+	name := paramName
+
+	if ref.stripPrefix {
+		name = strings.TrimPrefix(name, strings.TrimSuffix(ref.path, "/")+"/")
+	}
+
+	name = strings.TrimPrefix(name, "/")
+
+	if ref.replaceSeparators {
+		name = strings.NewReplacer("/", "_", "-", "_").Replace(name)
+	}
+
+	if ref.uppercase {
+		name = strings.ToUpper(name)
+	}
+
+	return strings.Replace(pattern, "*", name, 1)
+}
+
+type SSMGetParametersByPathAPI interface {
+	GetParametersByPath(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error)
+}
+
+func getParametersByPath(ctx context.Context, api SSMGetParametersByPathAPI, path string, recursive bool) (map[string]string, error) {
+	input := &ssm.GetParametersByPathInput{
+		Path:           aws.String(path),
+		Recursive:      aws.Bool(recursive),
+		WithDecryption: aws.Bool(true),
+	}
+
+	paginator := ssm.NewGetParametersByPathPaginator(api, input)
+	values := map[string]string{}
+
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, param := range output.Parameters {
+			values[aws.ToString(param.Name)] = aws.ToString(param.Value)
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,162 @@
+package sev
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// parameterStoreProvider resolves "parameterstore://" references.
+// A wildcard key imports the parameters under a path.
+type parameterStoreProvider struct {
+	clients ProviderssIface
+}
+
+func (p *parameterStoreProvider) Scheme() string {
+	return strings.TrimSuffix(PrefixParameterStore, "://")
+}
+
+func (p *parameterStoreProvider) Resolve(ctx context.Context, ref *Reference) (string, error) {
+	result := p.ResolveBatch(ctx, []*Reference{ref}, 1)[0]
+	return result.Value, result.Err
+}
+
+// ResolveBatch fetches each parameter and path once, grouped by target.
+func (p *parameterStoreProvider) ResolveBatch(ctx context.Context, refs []*Reference, concurrency int) []Result {
+	results := make([]Result, len(refs))
+	paramRefs := make([]*parameterRef, len(refs))
+	paramRefByKey := map[string]*parameterRef{}
+	paramKeysByTarget := map[AWSTarget][]string{}
+	pathRefs := make([]*parameterPathRef, len(refs))
+	pathRefByKey := map[string]*parameterPathRef{}
+	pathKeysByTarget := map[AWSTarget][]string{}
+
+	for i, ref := range refs {
+		if ref.Wildcard() {
+			pref, err := parseParameterPathRef(ref.Path())
+
+			if err != nil {
+				results[i].Err = err
+				continue
+			}
+
+			pathRefs[i] = pref
+
+			if _, ok := pathRefByKey[pref.key()]; !ok {
+				pathRefByKey[pref.key()] = pref
+				pathKeysByTarget[pref.target] = append(pathKeysByTarget[pref.target], pref.key())
+			}
+		} else {
+			pref, err := parseParameterRef(ref.Path())
+
+			if err != nil {
+				results[i].Err = err
+				continue
+			}
+
+			paramRefs[i] = pref
+
+			if _, ok := paramRefByKey[pref.key()]; !ok {
+				paramRefByKey[pref.key()] = pref
+				paramKeysByTarget[pref.target] = append(paramKeysByTarget[pref.target], pref.key())
+			}
+		}
+	}
+
+	params := map[string]fetchResult[string]{}
+
+	for _, target := range sortedTargets(paramKeysByTarget) {
+		svc, err := p.clients.NewSSMClient(target)
+
+		if err != nil {
+			for _, paramKey := range paramKeysByTarget[target] {
+				params[paramKey] = fetchResult[string]{err: err}
+			}
+
+			continue
+		}
+
+		maps.Copy(params, fetchConcurrently(paramKeysByTarget[target], MaxGetParametersNames, concurrency, func(paramKeys []string) map[string]fetchResult[string] {
+			paramNames := []string{}
+
+			for _, paramKey := range paramKeys {
+				paramNames = append(paramNames, paramRefByKey[paramKey].name)
+			}
+
+			values, invalid, err := getParameters(ctx, svc, paramNames)
+			results := map[string]fetchResult[string]{}
+
+			for _, paramKey := range paramKeys {
+				paramName := paramRefByKey[paramKey].name
+
+				if err != nil {
+					results[paramKey] = fetchResult[string]{err: err}
+				} else if slices.Contains(invalid, paramName) {
+					results[paramKey] = fetchResult[string]{err: fmt.Errorf("invalid parameter: %s", paramName)}
+				} else if value, ok := values[paramName]; ok {
+					results[paramKey] = fetchResult[string]{value: value}
+				} else {
+					results[paramKey] = fetchResult[string]{err: fmt.Errorf("parameter could not be found in response: %s", paramName)}
+				}
+			}
+
+			return results
+		}))
+	}
+
+	paths := map[string]fetchResult[map[string]string]{}
+
+	for _, target := range sortedTargets(pathKeysByTarget) {
+		svc, err := p.clients.NewSSMClient(target)
+
+		if err != nil {
+			for _, pathKey := range pathKeysByTarget[target] {
+				paths[pathKey] = fetchResult[map[string]string]{err: err}
+			}
+
+			continue
+		}
+
+		maps.Copy(paths, fetchConcurrently(pathKeysByTarget[target], 1, concurrency, func(pathKeys []string) map[string]fetchResult[map[string]string] {
+			pref := pathRefByKey[pathKeys[0]]
+			values, err := getParametersByPath(ctx, svc, pref.path, pref.recursive)
+			return map[string]fetchResult[map[string]string]{pathKeys[0]: {value: values, err: err}}
+		}))
+	}
+
+	for i, ref := range refs {
+		if pref := paramRefs[i]; pref != nil {
+			results[i].Value, results[i].Err = params[pref.key()].value, params[pref.key()].err
+		} else if pref := pathRefs[i]; pref != nil {
+			path := paths[pref.key()]
+			results[i].Err = path.err
+
+			if path.err == nil {
+				results[i].Env, results[i].Err = pref.expand(ref.Name, path.value)
+			}
+		}
+	}
+
+	return results
+}
+
+// expand names the parameters under the path after pattern.
+func (ref *parameterPathRef) expand(pattern string, values map[string]string) (map[string]string, error) {
+	env := map[string]string{}
+	expandedFrom := map[string]string{}
+
+	for _, paramName := range slices.Sorted(maps.Keys(values)) {
+		envName := ref.envName(pattern, paramName)
+
+		if other, ok := expandedFrom[envName]; ok {
+			return nil, fmt.Errorf("duplicate variable %s expanded from %s and %s", envName, other, paramName)
+		}
+
+		expandedFrom[envName] = paramName
+		env[envName] = values[paramName]
+	}
+
+	return env, nil
+}
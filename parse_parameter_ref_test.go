@@ -0,0 +1,87 @@
+package sev_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/winebarrel/sev"
+)
+
+func Test_parseParameterRef_OK(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tt := map[string]string{
+		"/foo/bar/zoo":            "/foo/bar/zoo",
+		"foo/bar/zoo":             "/foo/bar/zoo",
+		"/foo/bar/zoo:3":          "/foo/bar/zoo:3",
+		"foo/bar/zoo:prod-label":  "/foo/bar/zoo:prod-label",
+		"/foo/bar/zoo:prod.label": "/foo/bar/zoo:prod.label",
+	}
+
+	for from, expected := range tt {
+		name, target, err := sev.ParseParameterRef(from)
+		require.NoError(err)
+		assert.Equal(expected, name)
+		assert.Equal(sev.AWSTarget{}, target)
+	}
+}
+
+func Test_parseParameterRef_Target(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	type result struct {
+		name   string
+		target sev.AWSTarget
+	}
+
+	tt := map[string]result{
+		"/foo/bar?region=ap-northeast-1": {
+			name:   "/foo/bar",
+			target: sev.AWSTarget{Region: "ap-northeast-1"},
+		},
+		"foo/bar:3?aws_profile=shared&region=eu-west-1": {
+			name:   "/foo/bar:3",
+			target: sev.AWSTarget{Region: "eu-west-1", Profile: "shared"},
+		},
+		"arn:aws:ssm:ap-northeast-1:123456789012:parameter/foo/bar": {
+			name:   "arn:aws:ssm:ap-northeast-1:123456789012:parameter/foo/bar",
+			target: sev.AWSTarget{Region: "ap-northeast-1"},
+		},
+		"arn:aws:ssm:ap-northeast-1:123456789012:parameter/foo/bar:prod?region=us-west-2": {
+			name:   "arn:aws:ssm:ap-northeast-1:123456789012:parameter/foo/bar:prod",
+			target: sev.AWSTarget{Region: "us-west-2"},
+		},
+	}
+
+	for from, expected := range tt {
+		name, target, err := sev.ParseParameterRef(from)
+		require.NoError(err)
+		assert.Equal(expected, result{name: name, target: target})
+	}
+}
+
+func Test_parseParameterRef_Err(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := map[string]string{
+		"/":                 "parameter name is empty: '/'",
+		"/foo/bar/zoo:":     "selector is empty: '/foo/bar/zoo:'",
+		"/foo/bar/zoo:0":    "invalid parameter version in '/foo/bar/zoo:0': '0'",
+		"/foo/bar/zoo:-1":   "invalid parameter version in '/foo/bar/zoo:-1': '-1'",
+		"/foo/bar/zoo:1abc": "invalid parameter label in '/foo/bar/zoo:1abc': '1abc'",
+		"/foo/bar/zoo:aws1": "invalid parameter label in '/foo/bar/zoo:aws1': 'aws1'",
+		"/foo/bar/zoo:SSM":  "invalid parameter label in '/foo/bar/zoo:SSM': 'SSM'",
+		"/foo/bar/zoo:a:b":  "invalid parameter label in '/foo/bar/zoo:a:b': 'a:b'",
+		"/foo/bar/zoo:a b":  "invalid parameter label in '/foo/bar/zoo:a b': 'a b'",
+		"/foo?stage=x":      "unknown query parameter in '/foo': 'stage'",
+		"arn:aws:ssm:ap-northeast-1:123456789012:parameter/foo:": "selector is empty: 'arn:aws:ssm:ap-northeast-1:123456789012:parameter/foo:'",
+	}
+
+	for from, expected := range tt {
+		_, _, err := sev.ParseParameterRef(from)
+		assert.EqualError(err, expected)
+	}
+}
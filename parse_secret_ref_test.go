@@ -0,0 +1,70 @@
+package sev_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/winebarrel/sev"
+)
+
+func Test_parseSecretRef_Target(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	type result struct {
+		secretID string
+		key      string
+		target   sev.AWSTarget
+	}
+
+	tt := map[string]result{
+		"foo/bar:zoo": {
+			secretID: "foo/bar",
+			key:      "zoo",
+		},
+		"foo/bar:zoo?region=ap-northeast-1&aws_profile=shared": {
+			secretID: "foo/bar",
+			key:      "zoo",
+			target:   sev.AWSTarget{Region: "ap-northeast-1", Profile: "shared"},
+		},
+		"arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:foo/bar-AbCdEf": {
+			secretID: "arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:foo/bar-AbCdEf",
+			target:   sev.AWSTarget{Region: "ap-northeast-1"},
+		},
+		"arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:foo/bar-AbCdEf:zoo?aws_profile=shared": {
+			secretID: "arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:foo/bar-AbCdEf",
+			key:      "zoo",
+			target:   sev.AWSTarget{Region: "ap-northeast-1", Profile: "shared"},
+		},
+		"arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:foo/bar-AbCdEf?region=us-west-2": {
+			secretID: "arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:foo/bar-AbCdEf",
+			target:   sev.AWSTarget{Region: "us-west-2"},
+		},
+	}
+
+	for from, expected := range tt {
+		secretID, key, target, err := sev.ParseSecretRef(from)
+		require.NoError(err)
+		assert.Equal(expected, result{secretID: secretID, key: key, target: target})
+	}
+}
+
+func Test_parseSecretRef_Err(t *testing.T) {
+	tt := []struct {
+		from string
+		err  string
+	}{
+		{from: "app/db?stage=AWSPENDING:PASSWORD", err: "invalid value of 'stage' in 'app/db?stage=AWSPENDING:PASSWORD': 'AWSPENDING:PASSWORD': put the JSON key before the query, e.g. 'app/db:PASSWORD?stage=AWSPENDING'"},
+		{from: "app/db?version_id=EXAMPLE1-90ab-cdef-fedc-ba987EXAMPLE:PASSWORD", err: "invalid value of 'version_id' in 'app/db?version_id=EXAMPLE1-90ab-cdef-fedc-ba987EXAMPLE:PASSWORD': 'EXAMPLE1-90ab-cdef-fedc-ba987EXAMPLE:PASSWORD': put the JSON key before the query, e.g. 'app/db:PASSWORD?version_id=EXAMPLE1-90ab-cdef-fedc-ba987EXAMPLE'"},
+		{from: "?stage=AWSPENDING", err: "secret ID is empty: '?stage=AWSPENDING'"},
+		{from: "app/db?label=prod", err: "unknown query parameter in 'app/db?label=prod': 'label'"},
+	}
+
+	for _, t1 := range tt {
+		t.Run(t1.from, func(t *testing.T) {
+			_, _, _, err := sev.ParseSecretRef(t1.from)
+			assert.EqualError(t, err, t1.err)
+		})
+	}
+}
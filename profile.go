@@ -0,0 +1,146 @@
+package sev
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const (
+	KeyExtends  = "extends"
+	KeySettings = "_sev"
+)
+
+// configProfile is a table in the sev config. "extends" names one or more parent profiles,
+// the "_sev" table holds AWS and Vault settings, and every other key is an environment variable.
+// files records the config file each variable came from.
+type configProfile struct {
+	extends     []string
+	extendsFile string
+	settings    map[string]any
+	env         map[string]string
+	files       map[string]string
+}
+
+func (p *configProfile) UnmarshalTOML(data any) error {
+	table, ok := data.(map[string]any)
+
+	if !ok {
+		return fmt.Errorf("profile must be a table")
+	}
+
+	p.settings = map[string]any{}
+	p.env = map[string]string{}
+
+	for name, value := range table {
+		if name == KeySettings {
+			settings, ok := value.(map[string]any)
+
+			if !ok {
+				return fmt.Errorf("%s must be a table", KeySettings)
+			}
+
+			for key, v := range settings {
+				if !slices.Contains(awsSettingKeys, key) && key != KeyVaultSettings {
+					return fmt.Errorf("unknown key in %s: %s", KeySettings, key)
+				}
+
+				p.settings[key] = v
+			}
+
+			continue
+		}
+
+		if name == KeyExtends {
+			switch v := value.(type) {
+			case string:
+				p.extends = []string{v}
+			case []any:
+				p.extends = []string{}
+
+				for _, parent := range v {
+					s, ok := parent.(string)
+
+					if !ok {
+						return fmt.Errorf("%s must be a string or an array of strings", KeyExtends)
+					}
+
+					p.extends = append(p.extends, s)
+				}
+			default:
+				return fmt.Errorf("%s must be a string or an array of strings", KeyExtends)
+			}
+
+			continue
+		}
+
+		s, ok := value.(string)
+
+		if !ok {
+			return fmt.Errorf("value of %s must be a string", name)
+		}
+
+		p.env[name] = s
+	}
+
+	return nil
+}
+
+// mergeProfiles merges the profiles of each config file into profiles key by key.
+// A key in a later file overrides the same key in an earlier one.
+func mergeProfiles(profiles map[string]*configProfile, fileProfiles map[string]*configProfile, file string) {
+	for name, fp := range fileProfiles {
+		p, ok := profiles[name]
+
+		if !ok {
+			p = &configProfile{settings: map[string]any{}, env: map[string]string{}, files: map[string]string{}}
+			profiles[name] = p
+		}
+
+		if fp.extends != nil {
+			p.extends = fp.extends
+			p.extendsFile = file
+		}
+
+		maps.Copy(p.settings, fp.settings)
+
+		for key, value := range fp.env {
+			p.env[key] = value
+			p.files[key] = file
+		}
+	}
+}
+
+// resolveProfile merges the parents of a profile in order, then the profile itself,
+// so later parents override earlier ones and the profile overrides all of them.
+func resolveProfile(profiles map[string]*configProfile, name string, chain []string) (*configProfile, error) {
+	if slices.Contains(chain, name) {
+		return nil, fmt.Errorf("profile inheritance cycle: %s", strings.Join(append(chain, name), " -> "))
+	}
+
+	p := profiles[name]
+	chain = append(chain, name)
+	resolved := &configProfile{settings: map[string]any{}, env: map[string]string{}, files: map[string]string{}}
+
+	for _, parent := range p.extends {
+		if _, ok := profiles[parent]; !ok {
+			return nil, fmt.Errorf("parent profile could not be found: %s (extended by %s in %s)", parent, name, p.extendsFile)
+		}
+
+		parentProfile, err := resolveProfile(profiles, parent, chain)
+
+		if err != nil {
+			return nil, err
+		}
+
+		maps.Copy(resolved.settings, parentProfile.settings)
+		maps.Copy(resolved.env, parentProfile.env)
+		maps.Copy(resolved.files, parentProfile.files)
+	}
+
+	maps.Copy(resolved.settings, p.settings)
+	maps.Copy(resolved.env, p.env)
+	maps.Copy(resolved.files, p.files)
+	return resolved, nil
+}
@@ -0,0 +1,214 @@
+package sev
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Reference is a variable whose value is fetched by a Provider.
+type Reference struct {
+	// Name is the variable name. It contains "*" for a wildcard key.
+	Name string
+	// URI is the value in the config file, e.g. "secretsmanager://foo/bar:KEY".
+	URI string
+	// File is the config file that defined the variable, or "" if unknown.
+	File string
+}
+
+// Path returns the URI without "<scheme>://".
+func (ref *Reference) Path() string {
+	_, path, _ := strings.Cut(ref.URI, "://")
+	return path
+}
+
+func (ref *Reference) Wildcard() bool {
+	return strings.Contains(ref.Name, "*")
+}
+
+// Provider resolves the references of one scheme, e.g. "secretsmanager" for "secretsmanager://...".
+type Provider interface {
+	Scheme() string
+	Resolve(ctx context.Context, ref *Reference) (string, error)
+}
+
+// Expander is implemented by providers that accept a wildcard key.
+// Expand returns the variables that the key expands to.
+type Expander interface {
+	Expand(ctx context.Context, ref *Reference) (map[string]string, error)
+}
+
+// BatchResolver is implemented by providers that resolve many references in fewer calls.
+// ResolveBatch returns one result per reference, in the order of refs, and is used instead of Resolve and Expand.
+type BatchResolver interface {
+	ResolveBatch(ctx context.Context, refs []*Reference, concurrency int) []Result
+}
+
+// Result is the value of a plain key, or the variables expanded from a wildcard key.
+type Result struct {
+	Value string
+	Env   map[string]string
+	Err   error
+}
+
+const PrefixLiteral = "literal://"
+
+var (
+	registeredMu sync.Mutex
+	registered   []Provider
+)
+
+// Register makes a provider available to Run and Export.
+// A provider for the scheme of a built-in provider replaces it.
+func Register(p Provider) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	registered = append(registered, p)
+}
+
+type registry struct {
+	schemes   []string
+	providers map[string]Provider
+}
+
+// newRegistry returns the built-in providers followed by the registered ones.
+// builtins replace the default built-ins of the same schemes, e.g. to configure them for a profile.
+// By default, vault:// uses the environment variables of the Vault CLI and cmd:// runs no command.
+func newRegistry(clients ProviderssIface, builtins ...Provider) *registry {
+	r := &registry{providers: map[string]Provider{}}
+	r.register(&secretsManagerProvider{clients: clients})
+	r.register(&parameterStoreProvider{clients: clients})
+	r.register(&vaultProvider{})
+	r.register(&kmsProvider{clients: clients})
+	r.register(&fileProvider{})
+	r.register(&dotenvProvider{})
+	r.register(&ageProvider{})
+	r.register(&cmdProvider{})
+	r.register(&literalProvider{})
+
+	for _, p := range builtins {
+		r.register(p)
+	}
+
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+
+	for _, p := range registered {
+		r.register(p)
+	}
+
+	return r
+}
+
+// literalProvider escapes a value that would otherwise be a reference, e.g. "literal://file:///tmp/app.db".
+type literalProvider struct{}
+
+func (p *literalProvider) Scheme() string {
+	return strings.TrimSuffix(PrefixLiteral, "://")
+}
+
+func (p *literalProvider) Resolve(_ context.Context, ref *Reference) (string, error) {
+	return ref.Path(), nil
+}
+
+func (r *registry) register(p Provider) {
+	if _, ok := r.providers[p.Scheme()]; !ok {
+		r.schemes = append(r.schemes, p.Scheme())
+	}
+
+	r.providers[p.Scheme()] = p
+}
+
+// lookup returns the provider for the scheme of value. Values of other schemes are literals.
+func (r *registry) lookup(value string) (Provider, bool) {
+	scheme, _, ok := strings.Cut(value, "://")
+
+	if !ok {
+		return nil, false
+	}
+
+	p, ok := r.providers[scheme]
+	return p, ok
+}
+
+func (r *registry) errWildcardLiteral(name string) error {
+	prefixes := []string{}
+
+	for _, scheme := range r.schemes {
+		p := r.providers[scheme]
+		_, expander := p.(Expander)
+		_, batch := p.(BatchResolver)
+
+		if expander || batch {
+			prefixes = append(prefixes, scheme+"://")
+		}
+	}
+
+	if len(prefixes) == 0 {
+		return fmt.Errorf("wildcard key requires a reference: %s", name)
+	}
+
+	list := prefixes[len(prefixes)-1]
+
+	if len(prefixes) > 1 {
+		list = strings.Join(prefixes[:len(prefixes)-1], ", ") + " or " + list
+	}
+
+	return fmt.Errorf("wildcard key requires a %s reference: %s", list, name)
+}
+
+// resolveAll resolves refs with p, concurrently unless p batches them itself.
+func resolveAll(ctx context.Context, p Provider, refs []*Reference, concurrency int) []Result {
+	if b, ok := p.(BatchResolver); ok {
+		return b.ResolveBatch(ctx, refs, concurrency)
+	}
+
+	names := []string{}
+	refByName := map[string]*Reference{}
+
+	for _, ref := range refs {
+		names = append(names, ref.Name)
+		refByName[ref.Name] = ref
+	}
+
+	resultByName := fetchConcurrently(names, 1, concurrency, func(names []string) map[string]fetchResult[Result] {
+		return map[string]fetchResult[Result]{names[0]: {value: resolveOne(ctx, p, refByName[names[0]])}}
+	})
+
+	results := []Result{}
+
+	for _, name := range names {
+		results = append(results, resultByName[name].value)
+	}
+
+	return results
+}
+
+func resolveOne(ctx context.Context, p Provider, ref *Reference) Result {
+	if b, ok := p.(BatchResolver); ok {
+		return b.ResolveBatch(ctx, []*Reference{ref}, 1)[0]
+	}
+
+	if !ref.Wildcard() {
+		value, err := p.Resolve(ctx, ref)
+		return Result{Value: value, Err: err}
+	}
+
+	e, ok := p.(Expander)
+
+	if !ok {
+		return Result{Err: fmt.Errorf("wildcard key is not supported by %s://", p.Scheme())}
+	}
+
+	env, err := e.Expand(ctx, ref)
+	return Result{Env: env, Err: err}
+}
+
+// schemesOf lists the schemes of refsByScheme in registration order.
+func (r *registry) schemesOf(refsByScheme map[string][]*Reference) []string {
+	return slices.DeleteFunc(slices.Clone(r.schemes), func(scheme string) bool {
+		return len(refsByScheme[scheme]) == 0
+	})
+}
@@ -0,0 +1,238 @@
+package sev_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/winebarrel/sev"
+)
+
+type fakeProvider struct {
+	scheme string
+	values map[string]string
+	refs   []*sev.Reference
+}
+
+func (p *fakeProvider) Scheme() string {
+	return p.scheme
+}
+
+func (p *fakeProvider) Resolve(_ context.Context, ref *sev.Reference) (string, error) {
+	p.refs = append(p.refs, ref)
+	value, ok := p.values[ref.Path()]
+
+	if !ok {
+		return "", fmt.Errorf("not found: %s", ref.Path())
+	}
+
+	return value, nil
+}
+
+type fakeExpander struct {
+	fakeProvider
+}
+
+func (p *fakeExpander) Expand(_ context.Context, ref *sev.Reference) (map[string]string, error) {
+	env := map[string]string{}
+
+	for key, value := range p.values {
+		if strings.HasPrefix(key, ref.Path()) {
+			env[strings.Replace(ref.Name, "*", strings.ToUpper(strings.TrimPrefix(key, ref.Path())), 1)] = value
+		}
+	}
+
+	return env, nil
+}
+
+type fakeBatchProvider struct {
+	fakeProvider
+	batches [][]string
+}
+
+func (p *fakeBatchProvider) ResolveBatch(ctx context.Context, refs []*sev.Reference, _ int) []sev.Result {
+	names := []string{}
+	results := []sev.Result{}
+
+	for _, ref := range refs {
+		names = append(names, ref.Name)
+		value, err := p.Resolve(ctx, ref)
+		results = append(results, sev.Result{Value: value, Err: err})
+	}
+
+	p.batches = append(p.batches, names)
+	return results
+}
+
+func Test_loadEnvWith_OK(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fake := &fakeProvider{
+		scheme: "fake",
+		values: map[string]string{"foo": "FOO_VALUE", "bar": "BAR_VALUE"},
+	}
+
+	envFrom := map[string]string{
+		"FOO": "fake://foo",
+		"BAR": "fake://bar",
+		"URL": "https://example.com",
+		"BAZ": "baz",
+	}
+
+	files := map[string]string{
+		"FOO": "/home/me/.sev.toml",
+	}
+
+	env, err := sev.LoadEnvWith(envFrom, files, fake)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"FOO": "FOO_VALUE",
+		"BAR": "BAR_VALUE",
+		"URL": "https://example.com",
+		"BAZ": "baz",
+	}, env)
+
+	assert.Equal([]*sev.Reference{
+		{Name: "BAR", URI: "fake://bar"},
+		{Name: "FOO", URI: "fake://foo", File: "/home/me/.sev.toml"},
+	}, fake.refs)
+}
+
+func Test_loadEnvWith_OK_Expander(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fake := &fakeExpander{fakeProvider{
+		scheme: "fake",
+		values: map[string]string{"app/host": "localhost", "app/port": "5432"},
+	}}
+
+	envFrom := map[string]string{
+		"DB_*":    "fake://app/",
+		"DB_PORT": "5433",
+	}
+
+	env, err := sev.LoadEnvWith(envFrom, nil, fake)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"DB_HOST": "localhost",
+		"DB_PORT": "5433",
+	}, env)
+}
+
+func Test_loadEnvWith_OK_BatchResolver(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fake := &fakeBatchProvider{fakeProvider: fakeProvider{
+		scheme: "fake",
+		values: map[string]string{"foo": "FOO_VALUE", "bar": "BAR_VALUE"},
+	}}
+
+	envFrom := map[string]string{
+		"FOO": "fake://foo",
+		"BAR": "fake://bar",
+	}
+
+	env, err := sev.LoadEnvWith(envFrom, nil, fake)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"FOO": "FOO_VALUE",
+		"BAR": "BAR_VALUE",
+	}, env)
+	assert.Equal([][]string{{"BAR", "FOO"}}, fake.batches)
+}
+
+func Test_loadEnvWith_OK_ReplaceBuiltin(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fake := &fakeProvider{
+		scheme: "secretsmanager",
+		values: map[string]string{"foo/bar": "BAZ"},
+	}
+
+	envFrom := map[string]string{
+		"FOO": "secretsmanager://foo/bar",
+	}
+
+	env, err := sev.LoadEnvWith(envFrom, nil, fake)
+	require.NoError(err)
+	assert.Equal(map[string]string{"FOO": "BAZ"}, env)
+}
+
+func Test_loadEnvWith_Err(t *testing.T) {
+	assert := assert.New(t)
+
+	fake := &fakeProvider{
+		scheme: "fake",
+		values: map[string]string{},
+	}
+
+	envFrom := map[string]string{
+		"FOO":   "fake://foo",
+		"BAR_*": "fake://bar/",
+		"ZOO_*": "zoo",
+	}
+
+	files := map[string]string{
+		"FOO": "/home/me/.sev.toml",
+	}
+
+	_, err := sev.LoadEnvWith(envFrom, files, fake)
+	assert.EqualError(err, "failed to get fake://bar/: wildcard key is not supported by fake://\n"+
+		"failed to get fake://foo (FOO in /home/me/.sev.toml): not found: foo\n"+
+		"failed to get zoo: wildcard key requires a secretsmanager://, parameterstore://, vault://, dotenv:// or age:// reference: ZOO_*")
+}
+
+func Test_loadEnvWith_Err_Duplicate(t *testing.T) {
+	assert := assert.New(t)
+
+	fake := &fakeExpander{fakeProvider{
+		scheme: "fake",
+		values: map[string]string{"a/host": "localhost", "x/a_host": "example.com"},
+	}}
+
+	envFrom := map[string]string{
+		"*":   "fake://x/",
+		"A_*": "fake://a/",
+	}
+
+	_, err := sev.LoadEnvWith(envFrom, nil, fake)
+	assert.EqualError(err, "duplicate variable A_HOST expanded from * and A_*")
+}
+
+func Test_dryRunWith(t *testing.T) {
+	assert := assert.New(t)
+
+	fake := &fakeExpander{fakeProvider{
+		scheme: "fake",
+		values: map[string]string{"foo": "FOO_VALUE", "app/host": "localhost"},
+	}}
+
+	envFrom := map[string]string{
+		"FOO":   "fake://foo",
+		"BAR":   "fake://bar",
+		"APP_*": "fake://app/",
+	}
+
+	out, err := sev.DryRunWith(envFrom, false, fake)
+	assert.EqualError(err, "dry run found 1 unreachable variable(s)")
+	assert.Equal(`NAME      FILE  SOURCE       VALUE     STATUS
+APP_HOST  -     fake://app/  ********  ok
+BAR       -     fake://bar   -         error: not found: bar
+FOO       -     fake://foo   ********  ok
+`, out)
+
+	delete(envFrom, "BAR")
+	out, err = sev.DryRunWith(envFrom, true, fake)
+	assert.NoError(err)
+	assert.Equal(`NAME      FILE  SOURCE       VALUE        STATUS
+APP_HOST  -     fake://app/  "localhost"  ok
+FOO       -     fake://foo   "FOO_VALUE"  ok
+`, out)
+}
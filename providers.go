@@ -1,54 +1,213 @@
 package sev
 
 import (
+	"cmp"
 	"context"
+	"fmt"
+	"slices"
+	"sync"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 )
 
+// Providers keeps one AWS config per AWS profile and a pool of clients per AWSTarget.
 type Providers struct {
-	awsConfigOptFns      AWSConfigOptFns
-	secretsmanagerClient *secretsmanager.Client
-	ssmClient            *ssm.Client
+	mu                    sync.Mutex
+	awsConfigOptFns       AWSConfigOptFns
+	settings              *AWSSettings
+	cfgs                  map[string]*aws.Config
+	secretsmanagerClients map[AWSTarget]*secretsmanager.Client
+	ssmClients            map[AWSTarget]*ssm.Client
+	kmsClients            map[AWSTarget]*kms.Client
 }
 
 type ProviderssIface interface {
-	NewSecretsManagerClient() (*secretsmanager.Client, error)
-	NewSSMClient() (*ssm.Client, error)
+	NewSecretsManagerClient(target AWSTarget) (*secretsmanager.Client, error)
+	NewSSMClient(target AWSTarget) (*ssm.Client, error)
+	NewKMSClient(target AWSTarget) (*kms.Client, error)
 }
 
-func NewProviders(fns AWSConfigOptFns) *Providers {
+func NewProviders(fns AWSConfigOptFns, settings *AWSSettings) *Providers {
 	return &Providers{
-		awsConfigOptFns: fns,
+		awsConfigOptFns:       fns,
+		settings:              settings,
+		cfgs:                  map[string]*aws.Config{},
+		secretsmanagerClients: map[AWSTarget]*secretsmanager.Client{},
+		ssmClients:            map[AWSTarget]*ssm.Client{},
+		kmsClients:            map[AWSTarget]*kms.Client{},
 	}
 }
 
-func (p *Providers) NewSecretsManagerClient() (*secretsmanager.Client, error) {
-	if p.secretsmanagerClient == nil {
-		cfg, err := config.LoadDefaultConfig(context.Background(), p.awsConfigOptFns...)
+// loadConfig is shared by all clients of an AWS profile so that a role is assumed (and an MFA token is asked for) only once.
+// The settings of the sev profile apply to its default credentials.
+func (p *Providers) loadConfig(target AWSTarget) (aws.Config, error) {
+	cfg, ok := p.cfgs[target.Profile]
+
+	if !ok {
+		optFns := slices.Clone(p.awsConfigOptFns)
+
+		if target.Profile == "" {
+			optFns = append(optFns, p.settings.loadOptions()...)
+		} else {
+			optFns = append(optFns, config.WithSharedConfigProfile(target.Profile))
+		}
+
+		loaded, err := config.LoadDefaultConfig(context.Background(), optFns...)
 
 		if err != nil {
-			return nil, err
+			return loaded, err
 		}
 
-		p.secretsmanagerClient = secretsmanager.NewFromConfig(cfg)
+		if target.Profile == "" {
+			p.settings.assumeRole(&loaded)
+		}
+
+		cfg = &loaded
+		p.cfgs[target.Profile] = cfg
+	}
+
+	targetCfg := cfg.Copy()
+
+	if target.Region != "" {
+		targetCfg.Region = target.Region
 	}
 
-	return p.secretsmanagerClient, nil
+	return targetCfg, nil
 }
 
-func (p *Providers) NewSSMClient() (*ssm.Client, error) {
-	if p.ssmClient == nil {
-		cfg, err := config.LoadDefaultConfig(context.Background(), p.awsConfigOptFns...)
+// endpointURL is the endpoint_url setting, which only applies to Secrets Manager and Parameter Store
+// so that STS (for role_arn) and KMS keep their own endpoints.
+// Like the other settings, it only applies to the default credentials and region of the sev profile;
+// a target in another region or AWS profile uses the default endpoint of that region.
+// It must be called after loadConfig has loaded the default config.
+func (p *Providers) endpointURL(target AWSTarget) *string {
+	if p.settings == nil || p.settings.EndpointURL == "" || target.Profile != "" {
+		return nil
+	}
 
-		if err != nil {
-			return nil, err
+	if target.Region != "" && target.Region != p.cfgs[""].Region {
+		return nil
+	}
+
+	return aws.String(p.settings.EndpointURL)
+}
+
+func (p *Providers) credentials() (aws.Credentials, aws.Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cfg, err := p.loadConfig(AWSTarget{})
+
+	if err != nil {
+		return aws.Credentials{}, cfg, err
+	}
+
+	creds, err := cfg.Credentials.Retrieve(context.Background())
+	return creds, cfg, err
+}
+
+// exportCredentials adds the credentials that sev uses to env when export_credentials is set.
+// Variables listed in the profile take precedence.
+func (p *Providers) exportCredentials(env map[string]string) error {
+	if p.settings == nil || !p.settings.ExportCredentials {
+		return nil
+	}
+
+	creds, cfg, err := p.credentials()
+
+	if err != nil {
+		return fmt.Errorf("failed to export credentials: %w", err)
+	}
+
+	credsEnv := map[string]string{
+		"AWS_ACCESS_KEY_ID":     creds.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY": creds.SecretAccessKey,
+		"AWS_SESSION_TOKEN":     creds.SessionToken,
+		"AWS_REGION":            cfg.Region,
+	}
+
+	for name, value := range credsEnv {
+		if _, ok := env[name]; !ok && value != "" {
+			env[name] = value
 		}
+	}
+
+	return nil
+}
+
+// NewSecretsManagerClient returns a pooled client for the target.
+// Targets that resolve to the same region and AWS profile share a client.
+func (p *Providers) NewSecretsManagerClient(target AWSTarget) (*secretsmanager.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cfg, err := p.loadConfig(target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	endpointURL := p.endpointURL(target)
+	target.Region = cfg.Region
+	svc, ok := p.secretsmanagerClients[target]
+
+	if !ok {
+		svc = secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) {
+			o.BaseEndpoint = cmp.Or(endpointURL, o.BaseEndpoint)
+		})
+		p.secretsmanagerClients[target] = svc
+	}
+
+	return svc, nil
+}
+
+// NewSSMClient returns a pooled client for the target.
+func (p *Providers) NewSSMClient(target AWSTarget) (*ssm.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cfg, err := p.loadConfig(target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	endpointURL := p.endpointURL(target)
+	target.Region = cfg.Region
+	svc, ok := p.ssmClients[target]
+
+	if !ok {
+		svc = ssm.NewFromConfig(cfg, func(o *ssm.Options) {
+			o.BaseEndpoint = cmp.Or(endpointURL, o.BaseEndpoint)
+		})
+		p.ssmClients[target] = svc
+	}
+
+	return svc, nil
+}
+
+// NewKMSClient returns a pooled client for the target.
+func (p *Providers) NewKMSClient(target AWSTarget) (*kms.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cfg, err := p.loadConfig(target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	target.Region = cfg.Region
+	svc, ok := p.kmsClients[target]
 
-		p.ssmClient = ssm.NewFromConfig(cfg)
+	if !ok {
+		svc = kms.NewFromConfig(cfg)
+		p.kmsClients[target] = svc
 	}
 
-	return p.ssmClient, nil
+	return svc, nil
 }
@@ -0,0 +1,435 @@
+package sev_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/winebarrel/sev"
+)
+
+func Test_Providers_Settings_AssumeRole(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://sts.eu-west-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		query, _ := url.ParseQuery(string(body))
+		assert.Equal("AssumeRole", query.Get("Action"))
+		assert.Equal("arn:aws:iam::123456789012:role/sev", query.Get("RoleArn"))
+		assert.Equal("EXTERNAL", query.Get("ExternalId"))
+		assert.Equal("1800", query.Get("DurationSeconds"))
+		assert.Contains(req.Header.Get("Authorization"), "Credential=AKIDPROCESS/")
+
+		return httpmock.NewStringResponse(http.StatusOK, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIAASSUMED</AccessKeyId>
+      <SecretAccessKey>dummy</SecretAccessKey>
+      <SessionToken>dummy</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+    <AssumedRoleUser>
+      <Arn>arn:aws:sts::123456789012:assumed-role/sev/session</Arn>
+      <AssumedRoleId>AROAEXAMPLE:session</AssumedRoleId>
+    </AssumedRoleUser>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`), nil
+	})
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.eu-west-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		assert.Contains(req.Header.Get("Authorization"), "Credential=ASIAASSUMED/")
+		assert.Contains(req.Header.Get("Authorization"), "/eu-west-1/secretsmanager/")
+		return httpmock.NewStringResponse(http.StatusOK, `{"SecretString":"BAZ"}`), nil
+	})
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	settings := &sev.AWSSettings{
+		Region:            "eu-west-1",
+		RoleARNs:          []string{"arn:aws:iam::123456789012:role/sev"},
+		ExternalID:        "EXTERNAL",
+		Duration:          30 * time.Minute,
+		CredentialProcess: `echo '{"Version":1,"AccessKeyId":"AKIDPROCESS","SecretAccessKey":"dummy"}'`,
+	}
+
+	providers := sev.NewProviders(sev.AWSConfigOptFns{config.WithHTTPClient(hc)}, settings)
+	svc, err := providers.NewSecretsManagerClient(sev.AWSTarget{})
+	require.NoError(err)
+
+	value, err := sev.GetSecretValue(context.Background(), svc, "foo/bar")
+	require.NoError(err)
+	assert.Equal("BAZ", value.String())
+	assert.Equal(1, httpmock.GetCallCountInfo()["POST https://sts.eu-west-1.amazonaws.com/"])
+}
+
+func Test_Providers_Settings_EndpointURL(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "http://localhost:4566/", func(req *http.Request) (*http.Response, error) {
+		assert.Contains(req.Header.Get("Authorization"), "/ap-northeast-1/ssm/")
+		return httpmock.NewStringResponse(http.StatusOK, `{"Parameter":{"Name":"/foo","Value":"BAR"}}`), nil
+	})
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	settings := &sev.AWSSettings{
+		Region:      "ap-northeast-1",
+		EndpointURL: "http://localhost:4566",
+	}
+
+	providers := sev.NewProviders(sev.AWSConfigOptFns{config.WithHTTPClient(hc)}, settings)
+	svc, err := providers.NewSSMClient(sev.AWSTarget{})
+	require.NoError(err)
+
+	value, err := sev.GetParameter(svc, "/foo")
+	require.NoError(err)
+	assert.Equal("BAR", value)
+}
+
+func Test_Providers_Settings_EndpointURL_AssumeRole(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	// endpoint_url is only for Secrets Manager and Parameter Store, so the role is assumed with STS itself.
+	httpmock.RegisterResponder(http.MethodPost, "https://sts.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, assumeRoleResponse("ASIAASSUMED")), nil
+	})
+
+	httpmock.RegisterResponder(http.MethodPost, "https://vpce-0123.secretsmanager.us-east-1.vpce.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		assert.Contains(req.Header.Get("Authorization"), "Credential=ASIAASSUMED/")
+		return httpmock.NewStringResponse(http.StatusOK, `{"SecretString":"BAZ"}`), nil
+	})
+
+	httpmock.RegisterResponder(http.MethodPost, "https://kms.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `{"Plaintext":"QkFa"}`), nil
+	})
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	settings := &sev.AWSSettings{
+		RoleARNs:    []string{"arn:aws:iam::123456789012:role/sev"},
+		EndpointURL: "https://vpce-0123.secretsmanager.us-east-1.vpce.amazonaws.com",
+	}
+
+	providers := sev.NewProviders(sev.AWSConfigOptFns{config.WithHTTPClient(hc)}, settings)
+	env, err := sev.LoadEnv(map[string]string{"FOO": "secretsmanager://foo/bar", "ZOO": "kms://Y2lwaGVyMQ=="}, nil, providers, 1)
+	require.NoError(err)
+	assert.Equal(map[string]string{"FOO": "BAZ", "ZOO": "BAZ"}, env)
+	assert.Equal(1, httpmock.GetCallCountInfo()["POST https://sts.us-east-1.amazonaws.com/"])
+}
+
+func Test_Providers_Settings_EndpointURL_Targets(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://vpce-0123.secretsmanager.ap-northeast-1.vpce.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		assert.Contains(req.Header.Get("Authorization"), "/ap-northeast-1/secretsmanager/")
+		return httpmock.NewStringResponse(http.StatusOK, `{"SecretString":"VPCE"}`), nil
+	})
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		assert.Contains(req.Header.Get("Authorization"), "/us-east-1/secretsmanager/")
+		return httpmock.NewStringResponse(http.StatusOK, `{"SecretString":"VIRGINIA"}`), nil
+	})
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.ap-northeast-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		assert.Contains(req.Header.Get("Authorization"), "Credential=AKIDSHARED/")
+		return httpmock.NewStringResponse(http.StatusOK, `{"SecretString":"SHARED"}`), nil
+	})
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config")
+	err := os.WriteFile(configFile, []byte("[profile shared]\n"), 0600)
+	require.NoError(err)
+	credentialsFile := filepath.Join(dir, "credentials")
+	err = os.WriteFile(credentialsFile, []byte("[shared]\naws_access_key_id = AKIDSHARED\naws_secret_access_key = dummy\n"), 0600)
+	require.NoError(err)
+
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	settings := &sev.AWSSettings{
+		Region:      "ap-northeast-1",
+		EndpointURL: "https://vpce-0123.secretsmanager.ap-northeast-1.vpce.amazonaws.com",
+	}
+
+	providers := sev.NewProviders(sev.AWSConfigOptFns{config.WithHTTPClient(hc)}, settings)
+
+	// endpoint_url applies to the default region of the sev profile, named or not.
+	for _, target := range []sev.AWSTarget{{}, {Region: "ap-northeast-1"}} {
+		svc, err := providers.NewSecretsManagerClient(target)
+		require.NoError(err)
+
+		value, err := sev.GetSecretValue(context.Background(), svc, "foo/bar")
+		require.NoError(err)
+		assert.Equal("VPCE", value.String())
+	}
+
+	// Another region uses its own endpoint.
+	svc, err := providers.NewSecretsManagerClient(sev.AWSTarget{Region: "us-east-1"})
+	require.NoError(err)
+
+	value, err := sev.GetSecretValue(context.Background(), svc, "foo/bar")
+	require.NoError(err)
+	assert.Equal("VIRGINIA", value.String())
+
+	// So does another AWS profile, even in the same region.
+	svc, err = providers.NewSecretsManagerClient(sev.AWSTarget{Region: "ap-northeast-1", Profile: "shared"})
+	require.NoError(err)
+
+	value, err = sev.GetSecretValue(context.Background(), svc, "foo/bar")
+	require.NoError(err)
+	assert.Equal("SHARED", value.String())
+}
+
+func Test_Providers_NoSettings(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://ssm.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		assert.Contains(req.Header.Get("Authorization"), "Credential=dummy/")
+		return httpmock.NewStringResponse(http.StatusOK, `{"Parameter":{"Name":"/foo","Value":"BAR"}}`), nil
+	})
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	providers := sev.NewProviders(sev.AWSConfigOptFns{config.WithHTTPClient(hc)}, nil)
+	svc, err := providers.NewSSMClient(sev.AWSTarget{})
+	require.NoError(err)
+
+	value, err := sev.GetParameter(svc, "/foo")
+	require.NoError(err)
+	assert.Equal("BAR", value)
+}
+
+func assumeRoleResponse(accessKeyID string) string {
+	return `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>` + accessKeyID + `</AccessKeyId>
+      <SecretAccessKey>dummy</SecretAccessKey>
+      <SessionToken>TOKEN-` + accessKeyID + `</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`
+}
+
+func Test_Providers_Settings_RoleChain(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+	defer sev.SetMFATokenProvider(func() (string, error) { return "123456", nil })()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://sts.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		query, _ := url.ParseQuery(string(body))
+		assert.Equal("my-session", query.Get("RoleSessionName"))
+
+		switch query.Get("RoleArn") {
+		case "arn:aws:iam::111111111111:role/hop1":
+			assert.Contains(req.Header.Get("Authorization"), "Credential=dummy/")
+			assert.Equal("arn:aws:iam::000000000000:mfa/me", query.Get("SerialNumber"))
+			assert.Equal("123456", query.Get("TokenCode"))
+			return httpmock.NewStringResponse(http.StatusOK, assumeRoleResponse("ASIAHOP1")), nil
+		case "arn:aws:iam::222222222222:role/hop2":
+			assert.Contains(req.Header.Get("Authorization"), "Credential=ASIAHOP1/")
+			assert.Empty(query.Get("SerialNumber"))
+			return httpmock.NewStringResponse(http.StatusOK, assumeRoleResponse("ASIAHOP2")), nil
+		default:
+			return httpmock.NewStringResponse(http.StatusBadRequest, ""), nil
+		}
+	})
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		assert.Contains(req.Header.Get("Authorization"), "Credential=ASIAHOP2/")
+		return httpmock.NewStringResponse(http.StatusOK, `{"SecretString":"BAZ"}`), nil
+	})
+
+	httpmock.RegisterResponder(http.MethodPost, "https://ssm.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		assert.Contains(req.Header.Get("Authorization"), "Credential=ASIAHOP2/")
+		return httpmock.NewStringResponse(http.StatusOK, `{"Parameter":{"Name":"/foo","Value":"BAR"}}`), nil
+	})
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	settings := &sev.AWSSettings{
+		RoleARNs:    []string{"arn:aws:iam::111111111111:role/hop1", "arn:aws:iam::222222222222:role/hop2"},
+		SessionName: "my-session",
+		MFASerial:   "arn:aws:iam::000000000000:mfa/me",
+	}
+
+	providers := sev.NewProviders(sev.AWSConfigOptFns{config.WithHTTPClient(hc)}, settings)
+	smSvc, err := providers.NewSecretsManagerClient(sev.AWSTarget{})
+	require.NoError(err)
+	ssmSvc, err := providers.NewSSMClient(sev.AWSTarget{})
+	require.NoError(err)
+
+	secret, err := sev.GetSecretValue(context.Background(), smSvc, "foo/bar")
+	require.NoError(err)
+	assert.Equal("BAZ", secret.String())
+
+	param, err := sev.GetParameter(ssmSvc, "/foo")
+	require.NoError(err)
+	assert.Equal("BAR", param)
+
+	// Both clients share the assumed role, so each hop is assumed once.
+	assert.Equal(2, httpmock.GetCallCountInfo()["POST https://sts.us-east-1.amazonaws.com/"])
+}
+
+func Test_Providers_ExportCredentials(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://sts.eu-west-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, assumeRoleResponse("ASIAASSUMED")), nil
+	})
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	settings := &sev.AWSSettings{
+		Region:            "eu-west-1",
+		RoleARNs:          []string{"arn:aws:iam::123456789012:role/sev"},
+		ExportCredentials: true,
+	}
+
+	providers := sev.NewProviders(sev.AWSConfigOptFns{config.WithHTTPClient(hc)}, settings)
+	env := map[string]string{"FOO": "BAR", "AWS_SESSION_TOKEN": "explicit"}
+	err := sev.ExportCredentials(providers, env)
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"FOO":                   "BAR",
+		"AWS_ACCESS_KEY_ID":     "ASIAASSUMED",
+		"AWS_SECRET_ACCESS_KEY": "dummy",
+		"AWS_SESSION_TOKEN":     "explicit",
+		"AWS_REGION":            "eu-west-1",
+	}, env)
+
+	// Without export_credentials, env is left as is.
+	providers = sev.NewProviders(sev.AWSConfigOptFns{config.WithHTTPClient(hc)}, &sev.AWSSettings{})
+	env = map[string]string{"FOO": "BAR"}
+	err = sev.ExportCredentials(providers, env)
+	require.NoError(err)
+	assert.Equal(map[string]string{"FOO": "BAR"}, env)
+}
+
+func Test_Providers_Targets(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://sts.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, assumeRoleResponse("ASIAASSUMED")), nil
+	})
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.ap-northeast-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		assert.Contains(req.Header.Get("Authorization"), "Credential=ASIAASSUMED/")
+		assert.Contains(req.Header.Get("Authorization"), "/ap-northeast-1/secretsmanager/")
+		return httpmock.NewStringResponse(http.StatusOK, `{"SecretString":"TOKYO"}`), nil
+	})
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.eu-central-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		assert.Contains(req.Header.Get("Authorization"), "Credential=AKIDSHARED/")
+		return httpmock.NewStringResponse(http.StatusOK, `{"SecretString":"SHARED"}`), nil
+	})
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config")
+	err := os.WriteFile(configFile, []byte("[profile shared]\n"), 0600)
+	require.NoError(err)
+	credentialsFile := filepath.Join(dir, "credentials")
+	err = os.WriteFile(credentialsFile, []byte("[shared]\naws_access_key_id = AKIDSHARED\naws_secret_access_key = dummy\n"), 0600)
+	require.NoError(err)
+
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	settings := &sev.AWSSettings{
+		RoleARNs: []string{"arn:aws:iam::123456789012:role/sev"},
+	}
+
+	providers := sev.NewProviders(sev.AWSConfigOptFns{config.WithHTTPClient(hc)}, settings)
+
+	// The default region and an explicit target for it share a client.
+	defaultSvc, err := providers.NewSecretsManagerClient(sev.AWSTarget{})
+	require.NoError(err)
+	usSvc, err := providers.NewSecretsManagerClient(sev.AWSTarget{Region: "us-east-1"})
+	require.NoError(err)
+	assert.Same(defaultSvc, usSvc)
+
+	tokyoSvc, err := providers.NewSecretsManagerClient(sev.AWSTarget{Region: "ap-northeast-1"})
+	require.NoError(err)
+	assert.NotSame(defaultSvc, tokyoSvc)
+
+	value, err := sev.GetSecretValue(context.Background(), tokyoSvc, "foo/bar")
+	require.NoError(err)
+	assert.Equal("TOKYO", value.String())
+
+	// A target with an AWS profile uses that profile's credentials, not role_arn.
+	sharedSvc, err := providers.NewSecretsManagerClient(sev.AWSTarget{Region: "eu-central-1", Profile: "shared"})
+	require.NoError(err)
+
+	value, err = sev.GetSecretValue(context.Background(), sharedSvc, "foo/bar")
+	require.NoError(err)
+	assert.Equal("SHARED", value.String())
+	assert.Equal(1, httpmock.GetCallCountInfo()["POST https://sts.us-east-1.amazonaws.com/"])
+}
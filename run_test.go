@@ -2,10 +2,12 @@ package sev
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -72,9 +74,11 @@ HOGE = "PIYO"
 		_stderr = buferr
 
 		options := &Options{
-			ConfigGlob: tomlFile.Name(),
-			Profile:    "profile1",
-			Command:    []string{"/bin/sh", "-c", "echo $FOO $BAR"},
+			ProfileOptions: ProfileOptions{
+				ConfigGlob: tomlFile.Name(),
+				Profile:    "profile1",
+			},
+			Command: []string{"/bin/sh", "-c", "echo $FOO $BAR"},
 		}
 
 		options.AWSConfigOptFns = append(options.AWSConfigOptFns, config.WithHTTPClient(hc))
@@ -92,9 +96,11 @@ HOGE = "PIYO"
 		_stderr = buferr
 
 		options := &Options{
-			ConfigGlob: tomlFile.Name(),
-			Profile:    "profile2",
-			Command:    []string{"/bin/sh", "-c", "echo $piyo $HOGE"},
+			ProfileOptions: ProfileOptions{
+				ConfigGlob: tomlFile.Name(),
+				Profile:    "profile2",
+			},
+			Command: []string{"/bin/sh", "-c", "echo $piyo $HOGE"},
 		}
 
 		options.AWSConfigOptFns = append(options.AWSConfigOptFns, config.WithHTTPClient(hc))
@@ -163,9 +169,11 @@ HOGE = "PIYO"
 		_stderr = buferr
 
 		options := &Options{
-			ConfigGlob: d + "/*.toml",
-			Profile:    "profile1",
-			Command:    []string{"/bin/sh", "-c", "echo $FOO $BAR"},
+			ProfileOptions: ProfileOptions{
+				ConfigGlob: d + "/*.toml",
+				Profile:    "profile1",
+			},
+			Command: []string{"/bin/sh", "-c", "echo $FOO $BAR"},
 		}
 
 		options.AWSConfigOptFns = append(options.AWSConfigOptFns, config.WithHTTPClient(hc))
@@ -183,9 +191,11 @@ HOGE = "PIYO"
 		_stderr = buferr
 
 		options := &Options{
-			ConfigGlob: d + "/*.toml",
-			Profile:    "profile2",
-			Command:    []string{"/bin/sh", "-c", "echo $piyo $HOGE"},
+			ProfileOptions: ProfileOptions{
+				ConfigGlob: d + "/*.toml",
+				Profile:    "profile2",
+			},
+			Command: []string{"/bin/sh", "-c", "echo $piyo $HOGE"},
 		}
 
 		options.AWSConfigOptFns = append(options.AWSConfigOptFns, config.WithHTTPClient(hc))
@@ -277,10 +287,12 @@ aws_secret_access_key = "dummy"
 		_stderr = buferr
 
 		options := &Options{
-			ConfigGlob:         tomlFile.Name(),
-			Profile:            "profile1",
-			Command:            []string{"/bin/sh", "-c", "echo $FOO $BAR"},
-			OverrideAwsProfile: true,
+			ProfileOptions: ProfileOptions{
+				ConfigGlob:         tomlFile.Name(),
+				Profile:            "profile1",
+				OverrideAwsProfile: true,
+			},
+			Command: []string{"/bin/sh", "-c", "echo $FOO $BAR"},
 		}
 
 		options.AWSConfigOptFns = append(options.AWSConfigOptFns, config.WithHTTPClient(hc))
@@ -298,10 +310,12 @@ aws_secret_access_key = "dummy"
 		_stderr = buferr
 
 		options := &Options{
-			ConfigGlob:         tomlFile.Name(),
-			Profile:            "profile2",
-			Command:            []string{"/bin/sh", "-c", "echo $piyo $HOGE"},
-			OverrideAwsProfile: true,
+			ProfileOptions: ProfileOptions{
+				ConfigGlob:         tomlFile.Name(),
+				Profile:            "profile2",
+				OverrideAwsProfile: true,
+			},
+			Command: []string{"/bin/sh", "-c", "echo $piyo $HOGE"},
 		}
 
 		options.AWSConfigOptFns = append(options.AWSConfigOptFns, config.WithHTTPClient(hc))
@@ -392,10 +406,12 @@ aws_secret_access_key = "dummy"
 	_stderr = buferr
 
 	options := &Options{
-		ConfigGlob:         tomlFile.Name(),
-		Profile:            "profile1",
-		Command:            []string{"/bin/sh", "-c", "echo $FOO $BAR"},
-		OverrideAwsProfile: true,
+		ProfileOptions: ProfileOptions{
+			ConfigGlob:         tomlFile.Name(),
+			Profile:            "profile1",
+			OverrideAwsProfile: true,
+		},
+		Command: []string{"/bin/sh", "-c", "echo $FOO $BAR"},
 	}
 
 	options.AWSConfigOptFns = append(options.AWSConfigOptFns, config.WithHTTPClient(hc))
@@ -405,3 +421,229 @@ aws_secret_access_key = "dummy"
 	assert.Equal("BAZ baz\n", bufout.String())
 	assert.Empty(buferr.String())
 }
+
+func Test_Export_OK(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tomlFile, _ := os.CreateTemp("", "")
+	defer os.Remove(tomlFile.Name())
+	tomlFile.WriteString(`[profile1]
+FOO = "bar"
+BAZ = "it's"
+`)
+	tomlFile.Sync()
+
+	defer func() {
+		_stdout = os.Stdout
+	}()
+
+	bufout := &bytes.Buffer{}
+	_stdout = bufout
+
+	options := &ExportOptions{
+		ProfileOptions: ProfileOptions{
+			ConfigGlob: tomlFile.Name(),
+			Profile:    "profile1",
+		},
+		Format: "bash",
+	}
+
+	err := Export(options)
+	require.NoError(err)
+
+	assert.Equal("export BAZ='it'\\''s'\nexport FOO='bar'\n", bufout.String())
+}
+
+func Test_Export_Err_InvalidName(t *testing.T) {
+	assert := assert.New(t)
+
+	tomlFile, _ := os.CreateTemp("", "")
+	defer os.Remove(tomlFile.Name())
+	tomlFile.WriteString(`[profile1]
+"FOO-BAR" = "baz"
+`)
+	tomlFile.Sync()
+
+	options := &ExportOptions{
+		ProfileOptions: ProfileOptions{
+			ConfigGlob: tomlFile.Name(),
+			Profile:    "profile1",
+		},
+		Format: "fish",
+	}
+
+	err := Export(options)
+	assert.EqualError(err, "invalid variable name for fish: FOO-BAR")
+}
+
+type upperProvider struct{}
+
+func (p *upperProvider) Scheme() string {
+	return "upper"
+}
+
+func (p *upperProvider) Resolve(_ context.Context, ref *Reference) (string, error) {
+	return strings.ToUpper(ref.Path()), nil
+}
+
+func Test_Export_OK_RegisteredProvider(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tomlFile, _ := os.CreateTemp("", "")
+	defer os.Remove(tomlFile.Name())
+	tomlFile.WriteString(`[profile1]
+FOO = "upper://bar"
+BAZ = "https://example.com"
+`)
+	tomlFile.Sync()
+
+	defer func() {
+		_stdout = os.Stdout
+		registered = nil
+	}()
+
+	bufout := &bytes.Buffer{}
+	_stdout = bufout
+	Register(&upperProvider{})
+
+	options := &ExportOptions{
+		ProfileOptions: ProfileOptions{
+			ConfigGlob: tomlFile.Name(),
+			Profile:    "profile1",
+		},
+		Format: "dotenv",
+	}
+
+	err := Export(options)
+	require.NoError(err)
+
+	assert.Equal("BAZ=\"https://example.com\"\nFOO=\"BAR\"\n", bufout.String())
+}
+
+func Test_Export_OK_MFA(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://sts.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		assert.Contains(string(body), "TokenCode=123456")
+
+		return httpmock.NewStringResponse(http.StatusOK, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIAMFA</AccessKeyId>
+      <SecretAccessKey>dummy</SecretAccessKey>
+      <SessionToken>TOKEN</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`), nil
+	})
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		assert.Contains(req.Header.Get("Authorization"), "Credential=ASIAMFA/")
+		return httpmock.NewStringResponse(http.StatusOK, `{"SecretString":"BAZ"}`), nil
+	})
+
+	tomlFile, _ := os.CreateTemp("", "")
+	defer os.Remove(tomlFile.Name())
+	tomlFile.WriteString(`[profile1]
+FOO = "secretsmanager://foo/bar"
+
+[profile1._sev]
+role_arn = "arn:aws:iam::123456789012:role/sev"
+mfa_serial = "arn:aws:iam::000000000000:mfa/me"
+`)
+	tomlFile.Sync()
+
+	origTTYPath := _ttyPath
+	_ttyPath = "/nonexistent/tty"
+
+	defer func() {
+		_stdin = os.Stdin
+		_stdout = os.Stdout
+		_stderr = os.Stderr
+		_ttyPath = origTTYPath
+	}()
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+
+	bufout := &bytes.Buffer{}
+	buferr := &bytes.Buffer{}
+	_stdin = strings.NewReader("123456\n")
+	_stdout = bufout
+	_stderr = buferr
+
+	options := &ExportOptions{
+		ProfileOptions: ProfileOptions{
+			ConfigGlob: tomlFile.Name(),
+			Profile:    "profile1",
+		},
+		Format: "bash",
+	}
+
+	options.AWSConfigOptFns = append(options.AWSConfigOptFns, config.WithHTTPClient(hc))
+	err := Export(options)
+	require.NoError(err)
+
+	// The prompt must not end up in the shell code that is evaluated.
+	assert.Equal("export FOO='BAZ'\n", bufout.String())
+	assert.Equal("Assume Role MFA token code: ", buferr.String())
+}
+
+func Test_Run_OK_NoExec_RemoveTempFiles(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hc := &http.Client{}
+	httpmock.ActivateNonDefault(hc)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewStringResponse(http.StatusOK, `{"Name":"app/cert","SecretBinary":"AP8BAg=="}`), nil
+	})
+
+	tomlFile, _ := os.CreateTemp("", "")
+	defer os.Remove(tomlFile.Name())
+	tomlFile.WriteString(`[profile1]
+CERT_FILE = "secretsmanager://app/cert?binary=file"
+`)
+	tomlFile.Sync()
+
+	defer func() {
+		_stdout = os.Stdout
+	}()
+
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "dummy")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "dummy")
+	t.Setenv("TMPDIR", t.TempDir())
+
+	bufout := &bytes.Buffer{}
+	_stdout = bufout
+
+	options := &Options{
+		ProfileOptions: ProfileOptions{
+			ConfigGlob: tomlFile.Name(),
+			Profile:    "profile1",
+		},
+		Command: []string{"/bin/sh", "-c", `echo "$CERT_FILE"; od -An -tx1 "$CERT_FILE"`},
+	}
+
+	options.AWSConfigOptFns = append(options.AWSConfigOptFns, config.WithHTTPClient(hc))
+	err := Run(options)
+	require.NoError(err)
+
+	// The command can read the file, and it is removed once the command exits.
+	path, dump, _ := strings.Cut(bufout.String(), "\n")
+	assert.Equal("00 ff 01 02", strings.TrimSpace(dump))
+	assert.NoFileExists(path)
+}
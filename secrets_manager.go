@@ -0,0 +1,442 @@
+package sev
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/smithy-go"
+)
+
+// secretRef is a parsed "secretsmanager://" reference:
+//
+//	<secret-id>[:<json-key>][?stage=<version-stage>&version_id=<version-id>]
+//
+// The secret ID may be an ARN, whose region selects the client unless "region" is given.
+// "region" and "aws_profile" fetch the secret from another region or account.
+// A wildcard key spreads the JSON secret and accepts "include" and "exclude" key lists.
+// A binary secret is exported base64-encoded, or written to a temp file with "binary=file".
+type secretRef struct {
+	secretID     string
+	key          string
+	versionStage string
+	versionID    string
+	include      []string
+	exclude      []string
+	binaryFile   bool
+	target       AWSTarget
+}
+
+func parseSecretRef(from string) (*secretRef, error) {
+	path, rawQuery, _ := strings.Cut(from, "?")
+	query, err := url.ParseQuery(rawQuery)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query of '%s': %w", from, err)
+	}
+
+	ref := &secretRef{}
+
+	if strings.HasPrefix(path, "arn:") {
+		// arn:<partition>:secretsmanager:<region>:<account>:secret:<name>[:<json-key>]
+		parts := strings.SplitN(path, ":", 8)
+		ref.secretID = strings.Join(parts[:min(len(parts), 7)], ":")
+
+		if len(parts) == 8 {
+			ref.key = parts[7]
+		}
+	} else {
+		ref.secretID, ref.key, _ = strings.Cut(path, ":")
+	}
+
+	if ref.secretID == "" {
+		return nil, fmt.Errorf("secret ID is empty: '%s'", from)
+	}
+
+	for name := range query {
+		switch name {
+		case "stage":
+			ref.versionStage = query.Get(name)
+		case "version_id":
+			ref.versionID = query.Get(name)
+		case "include":
+			ref.include = splitList(query[name])
+		case "exclude":
+			ref.exclude = splitList(query[name])
+		case "binary":
+			switch query.Get(name) {
+			case "base64":
+				ref.binaryFile = false
+			case "file":
+				ref.binaryFile = true
+			default:
+				return nil, fmt.Errorf("invalid value of 'binary' in '%s': '%s'", from, query.Get(name))
+			}
+		default:
+			if !ref.target.setQuery(name, query.Get(name)) {
+				return nil, fmt.Errorf("unknown query parameter in '%s': '%s'", from, name)
+			}
+		}
+	}
+
+	// A JSON key goes before the query, so "id?stage=AWSPENDING:KEY" is a mistake for "id:KEY?stage=AWSPENDING".
+	for _, name := range []string{"stage", "version_id"} {
+		if version, key, ok := strings.Cut(query.Get(name), ":"); ok {
+			return nil, fmt.Errorf("invalid value of '%s' in '%s': '%s': put the JSON key before the query, e.g. '%s:%s?%s=%s'", name, from, query.Get(name), ref.secretID, key, name, version)
+		}
+	}
+
+	if ref.target.Region == "" {
+		ref.target.Region = regionFromARN(ref.secretID)
+	}
+
+	return ref, nil
+}
+
+func splitList(values []string) []string {
+	list := []string{}
+
+	for _, v := range values {
+		for item := range strings.SplitSeq(v, ",") {
+			if item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+
+	return list
+}
+
+func (ref *secretRef) validate(wildcard bool) error {
+	if wildcard && ref.key != "" {
+		return fmt.Errorf("wildcard key cannot select a JSON key: '%s'", ref.key)
+	}
+
+	if !wildcard && (len(ref.include) > 0 || len(ref.exclude) > 0) {
+		return fmt.Errorf("include/exclude requires a wildcard key")
+	}
+
+	return nil
+}
+
+func (ref *secretRef) pinned() bool {
+	return ref.versionStage != "" || ref.versionID != ""
+}
+
+// versionedID identifies one fetch: the secret ID plus the pinned version and the target, without the JSON key.
+func (ref *secretRef) versionedID() string {
+	query := url.Values{}
+	ref.target.encode(query)
+
+	if ref.versionStage != "" {
+		query.Set("stage", ref.versionStage)
+	}
+
+	if ref.versionID != "" {
+		query.Set("version_id", ref.versionID)
+	}
+
+	if len(query) == 0 {
+		return ref.secretID
+	}
+
+	return ref.secretID + "?" + query.Encode()
+}
+
+// source describes the reference in dry-run output. key overrides the JSON key, e.g. for a spread secret.
+func (ref *secretRef) source(key string) string {
+	if key == "" {
+		key = ref.key
+	}
+
+	parts := []string{"secretsmanager id=" + ref.secretID}
+
+	if key != "" {
+		parts = append(parts, "key="+key)
+	}
+
+	if ref.versionStage != "" {
+		parts = append(parts, "stage="+ref.versionStage)
+	}
+
+	if ref.versionID != "" {
+		parts = append(parts, "version_id="+ref.versionID)
+	}
+
+	if ref.target.Region != "" {
+		parts = append(parts, "region="+ref.target.Region)
+	}
+
+	if ref.target.Profile != "" {
+		parts = append(parts, "aws_profile="+ref.target.Profile)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+type secretValue struct {
+	secretString string
+	secretBinary []byte
+}
+
+func (v *secretValue) isBinary() bool {
+	return v.secretBinary != nil
+}
+
+func (v *secretValue) String() string {
+	if v.isBinary() {
+		return base64.StdEncoding.EncodeToString(v.secretBinary)
+	}
+
+	return v.secretString
+}
+
+func (ref *secretRef) resolve(v *secretValue) (string, error) {
+	if v.isBinary() {
+		if ref.key != "" {
+			return "", fmt.Errorf("cannot select a JSON key from binary secret '%s': '%s'", ref.secretID, ref.key)
+		}
+
+		if ref.binaryFile {
+			return writeTempFile(v.secretBinary)
+		}
+	} else if ref.key != "" {
+		return extractSecretKey(ref.secretID, v.secretString, ref.key)
+	}
+
+	return v.String(), nil
+}
+
+var (
+	tempFilesMu sync.Mutex
+	tempFiles   []string
+)
+
+// writeTempFile writes a binary secret for "binary=file".
+// Run removes the file after the command exits, unless sev was replaced by the command or the value was exported.
+func writeTempFile(data []byte) (string, error) {
+	f, err := os.CreateTemp("", "sev-")
+
+	if err != nil {
+		return "", err
+	}
+
+	tempFilesMu.Lock()
+	tempFiles = append(tempFiles, f.Name())
+	tempFilesMu.Unlock()
+
+	defer f.Close()
+	_, err = f.Write(data)
+
+	if err != nil {
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+func removeTempFiles() {
+	tempFilesMu.Lock()
+	defer tempFilesMu.Unlock()
+
+	for _, name := range tempFiles {
+		_ = os.Remove(name)
+	}
+
+	tempFiles = nil
+}
+
+type SecretsManagerBatchGetSecretValueAPI interface {
+	BatchGetSecretValue(ctx context.Context, params *secretsmanager.BatchGetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.BatchGetSecretValueOutput, error)
+}
+
+func getSecretValues(ctx context.Context, api SecretsManagerBatchGetSecretValueAPI, secretIDs []string) (map[string]*secretValue, map[string]error, error) {
+	input := &secretsmanager.BatchGetSecretValueInput{
+		SecretIdList: secretIDs,
+	}
+
+	output, err := api.BatchGetSecretValue(ctx, input)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := map[string]*secretValue{}
+	errs := map[string]error{}
+
+	for _, entry := range output.SecretValues {
+		for _, secretID := range secretIDs {
+			if secretID == aws.ToString(entry.Name) || secretID == aws.ToString(entry.ARN) {
+				values[secretID] = newSecretValue(entry.SecretString, entry.SecretBinary)
+			}
+		}
+	}
+
+	for _, apiErr := range output.Errors {
+		errs[aws.ToString(apiErr.SecretId)] = fmt.Errorf("%s: %s", aws.ToString(apiErr.ErrorCode), aws.ToString(apiErr.Message))
+	}
+
+	return values, errs, nil
+}
+
+func isAccessDenied(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDeniedException"
+}
+
+type SecretsManagerGetSecretValueAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+func newSecretValue(secretString *string, secretBinary []byte) *secretValue {
+	if secretString == nil && secretBinary != nil {
+		return &secretValue{secretBinary: secretBinary}
+	}
+
+	return &secretValue{secretString: aws.ToString(secretString)}
+}
+
+func getSecretValue(ctx context.Context, api SecretsManagerGetSecretValueAPI, from string) (*secretValue, error) {
+	ref, err := parseSecretRef(from)
+
+	if err != nil {
+		return nil, err
+	}
+
+	input := &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(ref.secretID),
+	}
+
+	if ref.versionStage != "" {
+		input.VersionStage = aws.String(ref.versionStage)
+	}
+
+	if ref.versionID != "" {
+		input.VersionId = aws.String(ref.versionID)
+	}
+
+	output, err := api.GetSecretValue(ctx, input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newSecretValue(output.SecretString, output.SecretBinary), nil
+}
+
+func parseSecretJSON(secretID string, value string) (any, error) {
+	jsonValue, err := decodeJSON(value)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", secretID, err)
+	}
+
+	return jsonValue, nil
+}
+
+func extractSecretKey(secretID string, value string, key string) (string, error) {
+	jsonValue, err := parseSecretJSON(secretID, value)
+
+	if err != nil {
+		return "", err
+	}
+
+	return selectJSONKey(secretID, jsonValue, key)
+}
+
+func (ref *secretRef) spread(v *secretValue) (map[string]string, error) {
+	if v.isBinary() {
+		return nil, fmt.Errorf("cannot expand binary secret '%s'", ref.secretID)
+	}
+
+	jsonValue, err := parseSecretJSON(ref.secretID, v.secretString)
+
+	if err != nil {
+		return nil, err
+	}
+
+	obj, ok := jsonValue.(map[string]any)
+
+	if !ok {
+		return nil, fmt.Errorf("failed to parse '%s': not a JSON object", ref.secretID)
+	}
+
+	values := map[string]string{}
+
+	for key, keyValue := range obj {
+		if len(ref.include) > 0 && !slices.Contains(ref.include, key) {
+			continue
+		}
+
+		if slices.Contains(ref.exclude, key) {
+			continue
+		}
+
+		values[key], err = renderJSONValue(keyValue)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, key := range ref.include {
+		if _, ok := obj[key]; !ok {
+			return nil, fmt.Errorf("key could not be found in '%s': '%s'", ref.secretID, key)
+		}
+	}
+
+	return values, nil
+}
+
+type SecretsManagerDescribeSecretAPI interface {
+	DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error)
+}
+
+// describeSecret checks that the secret and its pinned version exist without reading the value.
+func describeSecret(api SecretsManagerDescribeSecretAPI, from string) error {
+	ref, err := parseSecretRef(from)
+
+	if err != nil {
+		return err
+	}
+
+	input := &secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(ref.secretID),
+	}
+
+	output, err := api.DescribeSecret(context.Background(), input)
+
+	if err != nil {
+		return err
+	}
+
+	if ref.versionID != "" {
+		if _, ok := output.VersionIdsToStages[ref.versionID]; !ok {
+			return fmt.Errorf("version could not be found in '%s': '%s'", ref.secretID, ref.versionID)
+		}
+	}
+
+	if ref.versionStage != "" {
+		found := false
+
+		for versionID, stages := range output.VersionIdsToStages {
+			if slices.Contains(stages, ref.versionStage) && (ref.versionID == "" || versionID == ref.versionID) {
+				found = true
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("stage could not be found in '%s': '%s'", ref.secretID, ref.versionStage)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package sev
+
+import (
+	"context"
+	"maps"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// secretsManagerProvider resolves "secretsmanager://" references.
+// A wildcard key spreads the keys of a JSON secret.
+type secretsManagerProvider struct {
+	clients ProviderssIface
+}
+
+func (p *secretsManagerProvider) Scheme() string {
+	return strings.TrimSuffix(PrefixSecretsManager, "://")
+}
+
+func (p *secretsManagerProvider) Resolve(ctx context.Context, ref *Reference) (string, error) {
+	result := p.ResolveBatch(ctx, []*Reference{ref}, 1)[0]
+	return result.Value, result.Err
+}
+
+// ResolveBatch fetches each secret once, grouped by target, even if several references select keys of it.
+func (p *secretsManagerProvider) ResolveBatch(ctx context.Context, refs []*Reference, concurrency int) []Result {
+	results := make([]Result, len(refs))
+	secretRefs := make([]*secretRef, len(refs))
+	secretRefByID := map[string]*secretRef{}
+	secretIDsByTarget := map[AWSTarget][]string{}
+
+	for i, ref := range refs {
+		sref, err := parseSecretRef(ref.Path())
+
+		if err == nil {
+			err = sref.validate(ref.Wildcard())
+		}
+
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		secretRefs[i] = sref
+		secretID := sref.versionedID()
+
+		if _, ok := secretRefByID[secretID]; !ok {
+			secretRefByID[secretID] = sref
+			secretIDsByTarget[sref.target] = append(secretIDsByTarget[sref.target], secretID)
+		}
+	}
+
+	secrets := map[string]fetchResult[*secretValue]{}
+
+	for _, target := range sortedTargets(secretIDsByTarget) {
+		svc, err := p.clients.NewSecretsManagerClient(target)
+
+		if err != nil {
+			for _, secretID := range secretIDsByTarget[target] {
+				secrets[secretID] = fetchResult[*secretValue]{err: err}
+			}
+
+			continue
+		}
+
+		maps.Copy(secrets, fetchSecrets(ctx, svc, secretIDsByTarget[target], secretRefByID, concurrency))
+	}
+
+	for i, ref := range refs {
+		sref := secretRefs[i]
+
+		if sref == nil {
+			continue
+		}
+
+		secret := secrets[sref.versionedID()]
+
+		if secret.err != nil {
+			results[i].Err = secret.err
+			continue
+		}
+
+		if !ref.Wildcard() {
+			results[i].Value, results[i].Err = sref.resolve(secret.value)
+			continue
+		}
+
+		values, err := sref.spread(secret.value)
+
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		results[i].Env = map[string]string{}
+
+		for key, value := range values {
+			results[i].Env[strings.Replace(ref.Name, "*", key, 1)] = value
+		}
+	}
+
+	return results
+}
+
+func fetchSecrets(ctx context.Context, svc *secretsmanager.Client, versionedIDs []string, secretRefByID map[string]*secretRef, concurrency int) map[string]fetchResult[*secretValue] {
+	return fetchConcurrently(versionedIDs, MaxBatchGetSecretValueIDs, concurrency, func(versionedIDs []string) map[string]fetchResult[*secretValue] {
+		results := map[string]fetchResult[*secretValue]{}
+		batchIDs := []string{}
+
+		// BatchGetSecretValue always returns AWSCURRENT, so pinned versions are fetched one by one.
+		for _, versionedID := range versionedIDs {
+			if ref := secretRefByID[versionedID]; !ref.pinned() {
+				batchIDs = append(batchIDs, ref.secretID)
+			}
+		}
+
+		if len(batchIDs) > 1 {
+			values, secretErrs, err := getSecretValues(ctx, svc, batchIDs)
+
+			for _, versionedID := range versionedIDs {
+				ref := secretRefByID[versionedID]
+
+				if ref.pinned() {
+					continue
+				}
+
+				if err != nil && !isAccessDenied(err) {
+					results[versionedID] = fetchResult[*secretValue]{err: err}
+				} else if secretErr, ok := secretErrs[ref.secretID]; ok {
+					results[versionedID] = fetchResult[*secretValue]{err: secretErr}
+				} else if value, ok := values[ref.secretID]; ok {
+					results[versionedID] = fetchResult[*secretValue]{value: value}
+				}
+			}
+		}
+
+		// Fall back to single gets for secrets the batch did not resolve,
+		// e.g. when the IAM policy denies secretsmanager:BatchGetSecretValue.
+		for _, versionedID := range versionedIDs {
+			if _, ok := results[versionedID]; !ok {
+				value, err := getSecretValue(ctx, svc, versionedID)
+				results[versionedID] = fetchResult[*secretValue]{value: value, err: err}
+			}
+		}
+
+		return results
+	})
+}
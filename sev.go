@@ -2,18 +2,20 @@ package sev
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"os/exec"
+	"os/signal"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/BurntSushi/toml"
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
-	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/bmatcuk/doublestar/v4"
 )
 
@@ -27,39 +29,133 @@ const (
 	KeyAWSProfile        = "AWS_PROFILE"
 	PrefixSecretsManager = "secretsmanager://"
 	PrefixParameterStore = "parameterstore://"
+
+	MaxGetParametersNames     = 10
+	MaxBatchGetSecretValueIDs = 20
 )
 
 type AWSConfigOptFns []func(*config.LoadOptions) error
 
 func Run(options *Options) error {
-	envFrom, err := loadEnvFrom(options.ConfigGlob, options.Profile, options.DefaultProfile)
+	if options.DryRun {
+		p, providers, err := options.loadProfile()
+
+		if err != nil {
+			return err
+		}
+
+		reg, err := options.newRegistry(p, providers)
+
+		if err != nil {
+			return err
+		}
+
+		return dryRun(p.env, p.files, reg, options.Reveal)
+	}
+
+	// execve does not return on success, so the files are only removed when sev outlives the command.
+	defer removeTempFiles()
+	env, err := options.loadEnv()
 
 	if err != nil {
 		return err
 	}
 
-	optFns := options.AWSConfigOptFns
+	if options.Exec {
+		return execve(options.Command, env)
+	}
 
-	if options.OverrideAwsProfile {
-		awsProfile, ok := envFrom[KeyAWSProfile]
+	return execCmd(options.Command, env)
+}
 
-		if ok {
-			optFns = append(optFns, config.WithSharedConfigProfile(awsProfile))
-		}
+func Export(options *ExportOptions) error {
+	env, err := options.loadEnv()
+
+	if err != nil {
+		return err
 	}
 
-	providers := NewProviders(optFns)
-	env, err := loadEnv(envFrom, providers)
+	out, err := formatEnv(env, options.Format)
 
 	if err != nil {
 		return err
 	}
 
-	return execCmd(options.Command, env)
+	_, err = io.WriteString(_stdout, out)
+	return err
 }
 
-func loadEnvFrom(configGlob string, profile string, fallback string) (map[string]string, error) {
-	var envFromByProfile map[string]map[string]string
+func (options *ProfileOptions) loadEnv() (map[string]string, error) {
+	p, providers, err := options.loadProfile()
+
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := options.newRegistry(p, providers)
+
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := loadEnv(p.env, p.files, reg, options.Concurrency)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = providers.exportCredentials(env)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// newRegistry configures the built-in providers with the options and the settings of the profile.
+func (options *ProfileOptions) newRegistry(p *configProfile, providers *Providers) (*registry, error) {
+	vaultSettings, err := parseVaultSettings(p.settings)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newRegistry(providers,
+		&vaultProvider{settings: vaultSettings},
+		&cmdProvider{allow: options.AllowCmd, timeout: options.CmdTimeout},
+	), nil
+}
+
+func (options *ProfileOptions) loadProfile() (*configProfile, *Providers, error) {
+	p, err := loadProfile(options.ConfigGlob, options.Profile, options.DefaultProfile)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	settings, err := parseAWSSettings(p.settings)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	optFns := options.AWSConfigOptFns
+
+	if options.OverrideAwsProfile {
+		awsProfile, ok := p.env[KeyAWSProfile]
+
+		if ok {
+			optFns = append(optFns, config.WithSharedConfigProfile(awsProfile))
+		}
+	}
+
+	return p, NewProviders(optFns, settings), nil
+}
+
+// loadProfile reads the config files matching configGlob in path order and merges their profiles key by key,
+// so a later file overrides individual keys of an earlier one.
+func loadProfile(configGlob string, profile string, fallback string) (*configProfile, error) {
 	configs, err := doublestar.FilepathGlob(configGlob,
 		doublestar.WithFailOnIOErrors(),
 		doublestar.WithFailOnPatternNotExist(),
@@ -74,139 +170,173 @@ func loadEnvFrom(configGlob string, profile string, fallback string) (map[string
 		return nil, fmt.Errorf("pattern does not exist")
 	}
 
+	sort.Strings(configs)
+	profiles := map[string]*configProfile{}
+
 	for _, config := range configs {
-		_, err := toml.DecodeFile(config, &envFromByProfile)
+		var fileProfiles map[string]*configProfile
+		_, err := toml.DecodeFile(config, &fileProfiles)
 
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to parse %s: %w", config, err)
 		}
-	}
 
-	envFrom, ok := envFromByProfile[profile]
+		mergeProfiles(profiles, fileProfiles, config)
+	}
 
-	if !ok {
+	if _, ok := profiles[profile]; !ok {
 		if fallback == "" {
 			return nil, fmt.Errorf("profile could not be found: %s", profile)
 		}
 
-		envFrom, ok = envFromByProfile[fallback]
-
-		if !ok {
+		if _, ok := profiles[fallback]; !ok {
 			return nil, fmt.Errorf("fallback profile could not be found: %s", fallback)
 		}
+
+		profile = fallback
 	}
 
-	return envFrom, nil
+	return resolveProfile(profiles, profile, nil)
 }
 
-func loadEnv(envFrom map[string]string, providers ProviderssIface) (map[string]string, error) {
-	env := map[string]string{}
+// loadEnv resolves envFrom with the providers of reg. files maps each variable to the config file it came from, and is used in errors.
+func loadEnv(envFrom map[string]string, files map[string]string, reg *registry, concurrency int) (map[string]string, error) {
+	names := make([]string, 0, len(envFrom))
 
-	for name, from := range envFrom {
-		value := from
-
-		if strings.HasPrefix(from, PrefixSecretsManager) {
-			svc, err := providers.NewSecretsManagerClient()
+	for name := range envFrom {
+		names = append(names, name)
+	}
 
-			if err != nil {
-				return nil, err
-			}
+	sort.Strings(names)
+	errByName := map[string]error{}
+	refsByScheme := map[string][]*Reference{}
 
-			fromWitoutPrefix := strings.Replace(from, PrefixSecretsManager, "", 1)
-			value, err = getSecretValue(svc, fromWitoutPrefix)
+	for _, name := range names {
+		ref := &Reference{Name: name, URI: envFrom[name], File: files[name]}
 
-			if err != nil {
-				return nil, fmt.Errorf("failed to get %s: %w", from, err)
-			}
-		} else if strings.HasPrefix(from, PrefixParameterStore) {
-			svc, err := providers.NewSSMClient()
+		if p, ok := reg.lookup(ref.URI); ok {
+			refsByScheme[p.Scheme()] = append(refsByScheme[p.Scheme()], ref)
+		} else if ref.Wildcard() {
+			errByName[name] = reg.errWildcardLiteral(name)
+		}
+	}
 
-			if err != nil {
-				return nil, err
-			}
+	results := map[string]Result{}
 
-			fromWitoutPrefix := strings.Replace(from, PrefixParameterStore, "", 1)
+	for _, scheme := range reg.schemesOf(refsByScheme) {
+		refs := refsByScheme[scheme]
 
-			if !strings.HasPrefix(fromWitoutPrefix, "/") {
-				fromWitoutPrefix = "/" + fromWitoutPrefix
-			}
+		for i, result := range resolveAll(context.Background(), reg.providers[scheme], refs, concurrency) {
+			results[refs[i].Name] = result
+		}
+	}
 
-			value, err = getParameter(svc, fromWitoutPrefix)
+	env := map[string]string{}
+	errs := []error{}
+	expandedFrom := map[string]string{}
 
-			if err != nil {
-				return nil, fmt.Errorf("failed to get %s: %w", from, err)
-			}
+	failed := func(name string, err error) error {
+		if file, ok := files[name]; ok {
+			return fmt.Errorf("failed to get %s (%s in %s): %w", envFrom[name], name, file, err)
 		}
 
-		env[name] = value
+		return fmt.Errorf("failed to get %s: %w", envFrom[name], err)
 	}
 
-	return env, nil
-}
-
-type SecretsManagerGetSecretValueAPI interface {
-	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
-}
+	for _, name := range names {
+		if !strings.Contains(name, "*") || errByName[name] != nil {
+			continue
+		}
 
-func getSecretValue(api SecretsManagerGetSecretValueAPI, from string) (string, error) {
-	vkey := ""
+		result := results[name]
 
-	if strings.Contains(from, ":") {
-		idKey := strings.SplitN(from, ":", 2)
-		from = idKey[0]
-		vkey = idKey[1]
-	}
+		if result.Err != nil {
+			errs = append(errs, failed(name, result.Err))
+			continue
+		}
 
-	input := &secretsmanager.GetSecretValueInput{
-		SecretId: aws.String(from),
-	}
+		for _, envName := range slices.Sorted(maps.Keys(result.Env)) {
+			// Explicitly listed variables take precedence over expanded ones.
+			if _, ok := envFrom[envName]; ok {
+				continue
+			}
 
-	output, err := api.GetSecretValue(context.Background(), input)
+			if other, ok := expandedFrom[envName]; ok {
+				errs = append(errs, fmt.Errorf("duplicate variable %s expanded from %s and %s", envName, other, name))
+				continue
+			}
 
-	if err != nil {
-		return "", err
+			expandedFrom[envName] = name
+			env[envName] = result.Env[envName]
+		}
 	}
 
-	value := aws.ToString(output.SecretString)
+	for _, name := range names {
+		if strings.Contains(name, "*") && errByName[name] == nil {
+			continue
+		}
 
-	if vkey != "" {
-		var jsonValue map[string]string
-		err := json.Unmarshal([]byte(value), &jsonValue)
+		value := envFrom[name]
+		err := errByName[name]
+
+		if result, ok := results[name]; ok {
+			value, err = result.Value, result.Err
+		}
 
 		if err != nil {
-			return "", fmt.Errorf("failed to parse '%s': %w", from, err)
+			errs = append(errs, failed(name, err))
+			continue
 		}
 
-		vval, ok := jsonValue[vkey]
+		env[name] = value
+	}
 
-		if !ok {
-			return "", fmt.Errorf("key could not be found in '%s': '%s'", from, vkey)
-		}
+	err := errors.Join(errs...)
 
-		value = vval
+	if err != nil {
+		return nil, err
 	}
 
-	return value, nil
+	return env, nil
 }
 
-type SSMGetParameterAPI interface {
-	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+type fetchResult[T any] struct {
+	value T
+	err   error
 }
 
-func getParameter(api SSMGetParameterAPI, from string) (string, error) {
-	input := &ssm.GetParameterInput{
-		Name:           aws.String(from),
-		WithDecryption: aws.Bool(true),
+func fetchConcurrently[T any](keys []string, batchSize int, concurrency int, fetch func([]string) map[string]fetchResult[T]) map[string]fetchResult[T] {
+	if concurrency < 1 {
+		concurrency = 1
 	}
 
-	output, err := api.GetParameter(context.Background(), input)
+	batches := slices.Collect(slices.Chunk(keys, batchSize))
+	results := make([]map[string]fetchResult[T], len(batches))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
 
-	if err != nil {
-		return "", err
+	for i, batch := range batches {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			results[i] = fetch(batch)
+		}()
+	}
+
+	wg.Wait()
+	resultByKey := map[string]fetchResult[T]{}
+
+	for _, r := range results {
+		maps.Copy(resultByKey, r)
 	}
 
-	value := aws.ToString(output.Parameter.Value)
-	return value, nil
+	return resultByKey
 }
 
 func execCmd(cmdArgs []string, extraEnv map[string]string) error {
@@ -217,17 +347,70 @@ func execCmd(cmdArgs []string, extraEnv map[string]string) error {
 		args = cmdArgs[1:]
 	}
 
-	env := os.Environ()
-
-	for name, value := range extraEnv {
-		env = append(env, name+"="+value)
-	}
-
 	cmd := exec.Command(name, args...)
 	cmd.Stdin = _stdin
 	cmd.Stdout = _stdout
 	cmd.Stderr = _stderr
-	cmd.Env = env
+	cmd.Env = buildEnv(extraEnv)
+
+	sigs := make(chan os.Signal, 32)
+	notifySignals(sigs)
+	defer signal.Stop(sigs)
+
+	err := cmd.Start()
+
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				if isForwardable(sig) {
+					_ = cmd.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err = cmd.Wait()
+	var exitErr *exec.ExitError
+
+	if errors.As(err, &exitErr) {
+		return &ExitError{Code: exitCode(exitErr.ProcessState)}
+	}
+
+	return err
+}
+
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func buildEnv(extraEnv map[string]string) []string {
+	env := []string{}
+
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+
+		if _, ok := extraEnv[name]; !ok {
+			env = append(env, kv)
+		}
+	}
+
+	for name, value := range extraEnv {
+		env = append(env, name+"="+value)
+	}
 
-	return cmd.Run()
+	return env
 }
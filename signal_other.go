@@ -0,0 +1,21 @@
+//go:build !unix
+
+package sev
+
+import (
+	"os"
+	"os/signal"
+)
+
+// The console delivers Ctrl+C to the child as well, so sev only has to survive it.
+func notifySignals(c chan<- os.Signal) {
+	signal.Notify(c, os.Interrupt)
+}
+
+func isForwardable(sig os.Signal) bool {
+	return false
+}
+
+func exitCode(state *os.ProcessState) int {
+	return state.ExitCode()
+}
@@ -0,0 +1,68 @@
+//go:build unix
+
+package sev
+
+import (
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// forwardedSignals are relayed to the child. Job control signals (SIGTSTP, SIGTTIN and SIGTTOU) keep their
+// default action, so that Ctrl-Z stops sev together with the child.
+var forwardedSignals = []os.Signal{
+	syscall.SIGHUP,
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+	syscall.SIGTERM,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+	syscall.SIGWINCH,
+}
+
+// terminalSignals are sent by the terminal to its foreground process group, which the child shares with sev.
+var terminalSignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+	syscall.SIGWINCH,
+}
+
+var _inForeground = inForeground
+
+func notifySignals(c chan<- os.Signal) {
+	signal.Notify(c, forwardedSignals...)
+}
+
+// isForwardable reports whether the child would not get sig otherwise.
+// A terminal signal is not sent again when sev is in the foreground, since the child already got it.
+func isForwardable(sig os.Signal) bool {
+	if slices.Contains(terminalSignals, sig) {
+		return !_inForeground()
+	}
+
+	return slices.Contains(forwardedSignals, sig)
+}
+
+// inForeground reports whether sev is in the foreground process group of its controlling terminal.
+func inForeground() bool {
+	tty, err := os.Open("/dev/tty")
+
+	if err != nil {
+		return false
+	}
+
+	defer tty.Close()
+	pgrp, err := unix.IoctlGetInt(int(tty.Fd()), unix.TIOCGPGRP)
+	return err == nil && pgrp == syscall.Getpgrp()
+}
+
+func exitCode(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+
+	return state.ExitCode()
+}
@@ -0,0 +1,149 @@
+//go:build unix
+
+package sev
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func Test_execCmd_ForwardSignal(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cmd := []string{"/bin/sh", "-c", `trap 'echo got HUP; exit 7' HUP; echo ready; while :; do sleep 0.01; done`}
+
+	bufout := &syncBuffer{}
+	_stdout = bufout
+
+	defer func() {
+		_stdout = os.Stdout
+	}()
+
+	go func() {
+		for !strings.Contains(bufout.String(), "ready") {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	}()
+
+	err := execCmd(cmd, map[string]string{})
+	var exitErr *ExitError
+	require.ErrorAs(err, &exitErr)
+	assert.Equal(7, exitErr.Code)
+	assert.Equal("ready\ngot HUP\n", bufout.String())
+}
+
+func Test_execCmd_KilledBySignal(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cmd := []string{"/bin/sh", "-c", "kill -TERM $$"}
+
+	err := execCmd(cmd, map[string]string{})
+	var exitErr *ExitError
+	require.ErrorAs(err, &exitErr)
+	assert.Equal(128+int(syscall.SIGTERM), exitErr.Code)
+}
+
+// interruptChild runs a child that counts SIGINTs until SIGTERM, and calls send with its pid once it is ready.
+func interruptChild(t *testing.T, send func(pid int)) string {
+	cmd := []string{"/bin/sh", "-c", `n=0; trap 'n=$((n+1))' INT; trap 'echo "got $n"; exit 0' TERM; echo "ready $$"; while :; do sleep 0.01; done`}
+
+	bufout := &syncBuffer{}
+	_stdout = bufout
+
+	defer func() {
+		_stdout = os.Stdout
+	}()
+
+	go func() {
+		for !strings.Contains(bufout.String(), "ready") {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		var pid int
+		fmt.Sscanf(bufout.String(), "ready %d", &pid)
+		send(pid)
+		time.Sleep(200 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	}()
+
+	err := execCmd(cmd, map[string]string{})
+	require.NoError(t, err)
+	return bufout.String()
+}
+
+func Test_execCmd_InterruptOnce(t *testing.T) {
+	assert := assert.New(t)
+
+	orig := _inForeground
+	_inForeground = func() bool { return false }
+	defer func() { _inForeground = orig }()
+
+	// Not in the foreground of a terminal, e.g. "kill -INT <sev>" from a supervisor.
+	out := interruptChild(t, func(_ int) {
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+	})
+
+	assert.Contains(out, "got 1\n")
+}
+
+func Test_execCmd_InterruptOnce_Foreground(t *testing.T) {
+	assert := assert.New(t)
+
+	orig := _inForeground
+	_inForeground = func() bool { return true }
+	defer func() { _inForeground = orig }()
+
+	// Ctrl-C in a terminal sends SIGINT to both sev and the child.
+	// They are sent apart because a shell runs a trap once for signals that arrive together.
+	out := interruptChild(t, func(pid int) {
+		syscall.Kill(pid, syscall.SIGINT)
+		time.Sleep(100 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+	})
+
+	assert.Contains(out, "got 1\n")
+}
+
+func Test_isForwardable(t *testing.T) {
+	assert := assert.New(t)
+
+	orig := _inForeground
+	_inForeground = func() bool { return true }
+	defer func() { _inForeground = orig }()
+
+	assert.True(isForwardable(syscall.SIGTERM))
+	assert.True(isForwardable(syscall.SIGHUP))
+	assert.False(isForwardable(syscall.SIGINT))
+	assert.False(isForwardable(syscall.SIGTSTP))
+	assert.False(isForwardable(syscall.SIGCHLD))
+}
@@ -0,0 +1,349 @@
+package sev
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	PrefixVault      = "vault://"
+	KeyVaultSettings = "vault"
+
+	defaultKubernetesJWTFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// _vaultTimeout bounds each request, so that an unresponsive server does not hang sev.
+var _vaultTimeout = 30 * time.Second
+
+// VaultSettings is the "vault" table in "_sev". Unset values fall back to the environment variables of the Vault CLI.
+//
+//	[prod._sev.vault]
+//	address = "https://vault.example.com:8200" # $VAULT_ADDR
+//	namespace = "team-a"                        # $VAULT_NAMESPACE
+//	auth = "approle"                            # "token" (default: $VAULT_TOKEN or ~/.vault-token), "approle" or "kubernetes"
+//	auth_mount = "approle"                      # defaults to the name of the auth method
+//	role_id = "..."                             # approle: $VAULT_ROLE_ID
+//	secret_id_file = "~/.vault-secret-id"       # approle: $VAULT_SECRET_ID
+//	role = "app"                                # kubernetes
+//	jwt_file = "/path/to/token"                 # kubernetes: the service account token by default
+type VaultSettings struct {
+	Address      string
+	Namespace    string
+	Auth         string
+	AuthMount    string
+	RoleID       string
+	SecretIDFile string
+	Role         string
+	JWTFile      string
+}
+
+func parseVaultSettings(settings map[string]any) (*VaultSettings, error) {
+	s := &VaultSettings{}
+	value, ok := settings[KeyVaultSettings]
+
+	if !ok {
+		return s, nil
+	}
+
+	table, ok := value.(map[string]any)
+
+	if !ok {
+		return nil, fmt.Errorf("%s in %s must be a table", KeyVaultSettings, KeySettings)
+	}
+
+	for key, value := range table {
+		var field *string
+
+		switch key {
+		case "address":
+			field = &s.Address
+		case "namespace":
+			field = &s.Namespace
+		case "auth":
+			field = &s.Auth
+		case "auth_mount":
+			field = &s.AuthMount
+		case "role_id":
+			field = &s.RoleID
+		case "secret_id_file":
+			field = &s.SecretIDFile
+		case "role":
+			field = &s.Role
+		case "jwt_file":
+			field = &s.JWTFile
+		default:
+			return nil, fmt.Errorf("unknown key in %s.%s: %s", KeySettings, KeyVaultSettings, key)
+		}
+
+		var err error
+		*field, err = settingString(KeyVaultSettings+"."+key, value)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch s.Auth {
+	case "", "token", "approle", "kubernetes":
+	default:
+		return nil, fmt.Errorf("unknown auth method in %s.%s: %s", KeySettings, KeyVaultSettings, s.Auth)
+	}
+
+	return s, nil
+}
+
+// VaultClient reads secrets with the token it logged in with.
+type VaultClient struct {
+	address    string
+	namespace  string
+	token      string
+	httpClient *http.Client
+}
+
+func newVaultClient(ctx context.Context, s *VaultSettings, httpClient *http.Client) (*VaultClient, error) {
+	if s == nil {
+		s = &VaultSettings{}
+	}
+
+	c := &VaultClient{
+		address:    strings.TrimSuffix(cmp.Or(s.Address, os.Getenv("VAULT_ADDR")), "/"),
+		namespace:  cmp.Or(s.Namespace, os.Getenv("VAULT_NAMESPACE")),
+		httpClient: httpClient,
+	}
+
+	if c.address == "" {
+		return nil, fmt.Errorf("vault address is not set: set address in %s.%s or VAULT_ADDR", KeySettings, KeyVaultSettings)
+	}
+
+	var err error
+
+	switch s.Auth {
+	case "", "token":
+		c.token, err = vaultToken()
+	case "approle":
+		c.token, err = c.loginAppRole(ctx, s)
+	case "kubernetes":
+		c.token, err = c.loginKubernetes(ctx, s)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	home, err := os.UserHomeDir()
+
+	if err == nil {
+		token, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+
+		if err == nil {
+			return strings.TrimSpace(string(token)), nil
+		}
+	}
+
+	return "", fmt.Errorf("vault token is not set: set VAULT_TOKEN or run 'vault login'")
+}
+
+func (c *VaultClient) loginAppRole(ctx context.Context, s *VaultSettings) (string, error) {
+	roleID := cmp.Or(s.RoleID, os.Getenv("VAULT_ROLE_ID"))
+	secretID := os.Getenv("VAULT_SECRET_ID")
+
+	if s.SecretIDFile != "" {
+		data, err := os.ReadFile(expandHome(s.SecretIDFile))
+
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret_id_file: %w", err)
+		}
+
+		secretID = strings.TrimSpace(string(data))
+	}
+
+	if roleID == "" {
+		return "", fmt.Errorf("approle auth requires role_id in %s.%s or VAULT_ROLE_ID", KeySettings, KeyVaultSettings)
+	}
+
+	return c.login(ctx, cmp.Or(s.AuthMount, "approle"), map[string]string{"role_id": roleID, "secret_id": secretID})
+}
+
+func (c *VaultClient) loginKubernetes(ctx context.Context, s *VaultSettings) (string, error) {
+	if s.Role == "" {
+		return "", fmt.Errorf("kubernetes auth requires role in %s.%s", KeySettings, KeyVaultSettings)
+	}
+
+	jwt, err := os.ReadFile(expandHome(cmp.Or(s.JWTFile, defaultKubernetesJWTFile)))
+
+	if err != nil {
+		return "", fmt.Errorf("failed to read the service account token: %w", err)
+	}
+
+	return c.login(ctx, cmp.Or(s.AuthMount, "kubernetes"), map[string]string{"role": s.Role, "jwt": strings.TrimSpace(string(jwt))})
+}
+
+func (c *VaultClient) login(ctx context.Context, mount string, params map[string]string) (string, error) {
+	var resp struct {
+		Auth *struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+
+	err := c.do(ctx, http.MethodPost, "auth/"+strings.Trim(mount, "/")+"/login", nil, params, &resp)
+
+	if err != nil {
+		return "", fmt.Errorf("failed to log in to vault: %w", err)
+	}
+
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("failed to log in to vault: no client token in response")
+	}
+
+	return resp.Auth.ClientToken, nil
+}
+
+func (c *VaultClient) do(ctx context.Context, method string, path string, query url.Values, params any, out any) error {
+	u := c.address + "/v1/" + path
+
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var body io.Reader
+
+	if params != nil {
+		data, err := json.Marshal(params)
+
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+
+	if err != nil {
+		return err
+	}
+
+	if c.token != "" {
+		req.Header.Set("X-Vault-Token", c.token)
+	}
+
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+
+	resp, err := c.httpClient.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Errors []string `json:"errors"`
+		}
+
+		_ = json.Unmarshal(data, &errResp)
+
+		if len(errResp.Errors) > 0 {
+			return fmt.Errorf("%s %s: %d: %s", method, path, resp.StatusCode, strings.Join(errResp.Errors, "; "))
+		}
+
+		return fmt.Errorf("%s %s: %d", method, path, resp.StatusCode)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(out)
+}
+
+// vaultRef is a parsed "vault://" reference to the API path of a KV secret:
+//
+//	<path>[?version=<version>][#<key>]
+//
+// A KV v2 path includes "data/", e.g. "secret/data/app". The key selects a field like a Secrets Manager JSON key.
+type vaultRef struct {
+	path  string
+	query url.Values
+	key   string
+}
+
+func parseVaultRef(from string) (*vaultRef, error) {
+	rest, key, _ := strings.Cut(from, "#")
+	path, rawQuery, _ := strings.Cut(rest, "?")
+	query, err := url.ParseQuery(rawQuery)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query of '%s': %w", from, err)
+	}
+
+	for name := range query {
+		if name != "version" {
+			return nil, fmt.Errorf("unknown query parameter in '%s': '%s'", from, name)
+		}
+	}
+
+	ref := &vaultRef{path: strings.Trim(path, "/"), query: query, key: key}
+
+	if ref.path == "" {
+		return nil, fmt.Errorf("secret path is empty: '%s'", from)
+	}
+
+	return ref, nil
+}
+
+// readKV returns the fields of a KV v1 or v2 secret. A KV v2 response nests the fields next to "metadata".
+func (c *VaultClient) readKV(ctx context.Context, path string, query url.Values) (map[string]any, error) {
+	var resp struct {
+		Data map[string]any `json:"data"`
+	}
+
+	err := c.do(ctx, http.MethodGet, path, query, nil, &resp)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, isV2 := resp.Data["metadata"].(map[string]any)
+	_, hasData := resp.Data["data"]
+
+	if isV2 && hasData {
+		data, ok := resp.Data["data"].(map[string]any)
+
+		if !ok {
+			return nil, fmt.Errorf("secret has no data in '%s': it may be deleted", path)
+		}
+
+		return data, nil
+	}
+
+	if resp.Data == nil {
+		return nil, fmt.Errorf("secret has no data in '%s'", path)
+	}
+
+	return resp.Data, nil
+}
@@ -0,0 +1,113 @@
+package sev
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// vaultProvider resolves "vault://" references to HashiCorp Vault KV secrets.
+// A wildcard key spreads the fields of a secret.
+type vaultProvider struct {
+	settings *VaultSettings
+	login    sync.Once
+	client   *VaultClient
+	loginErr error
+	mu       sync.Mutex
+	reads    map[string]*vaultRead
+}
+
+// vaultRead is shared by references to the same secret so that it is read once.
+type vaultRead struct {
+	once sync.Once
+	data map[string]any
+	err  error
+}
+
+func (p *vaultProvider) Scheme() string {
+	return strings.TrimSuffix(PrefixVault, "://")
+}
+
+func (p *vaultProvider) Resolve(ctx context.Context, ref *Reference) (string, error) {
+	vref, data, err := p.read(ctx, ref)
+
+	if err != nil {
+		return "", err
+	}
+
+	if vref.key == "" {
+		return renderJSONValue(data)
+	}
+
+	return selectJSONKey(vref.path, data, vref.key)
+}
+
+func (p *vaultProvider) Expand(ctx context.Context, ref *Reference) (map[string]string, error) {
+	vref, data, err := p.read(ctx, ref)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if vref.key != "" {
+		return nil, fmt.Errorf("wildcard key cannot select a JSON key: '%s'", vref.key)
+	}
+
+	env := map[string]string{}
+
+	for key, value := range data {
+		env[strings.Replace(ref.Name, "*", key, 1)], err = renderJSONValue(value)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return env, nil
+}
+
+func (p *vaultProvider) read(ctx context.Context, ref *Reference) (*vaultRef, map[string]any, error) {
+	vref, err := parseVaultRef(ref.Path())
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	readKey := vref.path + "?" + vref.query.Encode()
+	p.mu.Lock()
+
+	if p.reads == nil {
+		p.reads = map[string]*vaultRead{}
+	}
+
+	r, ok := p.reads[readKey]
+
+	if !ok {
+		r = &vaultRead{}
+		p.reads[readKey] = r
+	}
+
+	p.mu.Unlock()
+
+	r.once.Do(func() {
+		var client *VaultClient
+		client, r.err = p.newClient(ctx)
+
+		if r.err == nil {
+			r.data, r.err = client.readKV(ctx, vref.path, vref.query)
+		}
+	})
+
+	return vref, r.data, r.err
+}
+
+// newClient logs in to Vault once and returns the client for all references.
+func (p *vaultProvider) newClient(ctx context.Context) (*VaultClient, error) {
+	p.login.Do(func() {
+		p.client, p.loginErr = newVaultClient(ctx, p.settings, &http.Client{Timeout: _vaultTimeout})
+	})
+
+	return p.client, p.loginErr
+}
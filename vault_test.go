@@ -0,0 +1,283 @@
+package sev_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/winebarrel/sev"
+)
+
+// newVaultServer stands in for Vault with a KV v2 mount at "secret" and a KV v1 mount at "kv".
+func newVaultServer(t *testing.T, token string) (*httptest.Server, map[string]int) {
+	calls := map[string]int{}
+	var mu sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls[r.Method+" "+r.URL.Path]++
+		mu.Unlock()
+
+		if r.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/app":
+			version := r.URL.Query().Get("version")
+
+			if version == "" {
+				version = "2"
+			}
+
+			w.Write([]byte(`{"data":{"data":{"user":"admin","password":"v` + version + `","db":{"port":5432}},"metadata":{"version":` + version + `}}}`))
+		case "/v1/secret/data/deleted":
+			w.Write([]byte(`{"data":{"data":null,"metadata":{"version":1,"deletion_time":"2024-01-01T00:00:00Z"}}}`))
+		case "/v1/kv/app":
+			w.Write([]byte(`{"data":{"api_key":"KEY1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+
+	t.Cleanup(server.Close)
+	return server, calls
+}
+
+func Test_loadEnv_Vault_Token(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, calls := newVaultServer(t, "s.token")
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "s.token")
+
+	envFrom := map[string]string{
+		"USER":     "vault://secret/data/app#user",
+		"PASSWORD": "vault://secret/data/app#password",
+		"PORT":     "vault://secret/data/app#db.port",
+		"OLD":      "vault://secret/data/app?version=1#password",
+		"APP":      "vault://kv/app",
+		"KV_*":     "vault://kv/app",
+	}
+
+	env, err := sev.LoadEnvWith(envFrom, nil, sev.NewVaultProvider(nil))
+	require.NoError(err)
+	assert.Equal(map[string]string{
+		"USER":       "admin",
+		"PASSWORD":   "v2",
+		"PORT":       "5432",
+		"OLD":        "v1",
+		"APP":        `{"api_key":"KEY1"}`,
+		"KV_api_key": "KEY1",
+	}, env)
+
+	// Each secret and version is read once.
+	assert.Equal(2, calls["GET /v1/secret/data/app"])
+	assert.Equal(1, calls["GET /v1/kv/app"])
+}
+
+func Test_loadEnv_Vault_AppRole(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, _ := newVaultServer(t, "s.approle")
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /v1/auth/my-approle/login", func(w http.ResponseWriter, r *http.Request) {
+		var params map[string]string
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &params)
+		assert.Equal(map[string]string{"role_id": "ROLE", "secret_id": "SECRET"}, params)
+		assert.Equal("team-a", r.Header.Get("X-Vault-Namespace"))
+		w.Write([]byte(`{"auth":{"client_token":"s.approle"}}`))
+	})
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("team-a", r.Header.Get("X-Vault-Namespace"))
+		server.Config.Handler.ServeHTTP(w, r)
+	})
+
+	proxy := httptest.NewServer(mux)
+	defer proxy.Close()
+
+	secretIDFile := filepath.Join(t.TempDir(), "secret-id")
+	os.WriteFile(secretIDFile, []byte("SECRET\n"), 0600)
+
+	provider := sev.NewVaultProvider(&sev.VaultSettings{
+		Address:      proxy.URL,
+		Namespace:    "team-a",
+		Auth:         "approle",
+		AuthMount:    "my-approle",
+		RoleID:       "ROLE",
+		SecretIDFile: secretIDFile,
+	})
+
+	env, err := sev.LoadEnvWith(map[string]string{"PASSWORD": "vault://secret/data/app#password"}, nil, provider)
+	require.NoError(err)
+	assert.Equal(map[string]string{"PASSWORD": "v2"}, env)
+}
+
+func Test_loadEnv_Vault_Kubernetes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	server, _ := newVaultServer(t, "s.k8s")
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /v1/auth/kubernetes/login", func(w http.ResponseWriter, r *http.Request) {
+		var params map[string]string
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &params)
+		assert.Equal(map[string]string{"role": "app", "jwt": "JWT"}, params)
+		w.Write([]byte(`{"auth":{"client_token":"s.k8s"}}`))
+	})
+
+	mux.Handle("/", server.Config.Handler)
+	proxy := httptest.NewServer(mux)
+	defer proxy.Close()
+
+	jwtFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(jwtFile, []byte("JWT"), 0600)
+
+	provider := sev.NewVaultProvider(&sev.VaultSettings{
+		Address: proxy.URL,
+		Auth:    "kubernetes",
+		Role:    "app",
+		JWTFile: jwtFile,
+	})
+
+	env, err := sev.LoadEnvWith(map[string]string{"API_KEY": "vault://kv/app#api_key"}, nil, provider)
+	require.NoError(err)
+	assert.Equal(map[string]string{"API_KEY": "KEY1"}, env)
+}
+
+func Test_loadEnv_Vault_Err(t *testing.T) {
+	assert := assert.New(t)
+
+	server, _ := newVaultServer(t, "s.token")
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "s.token")
+
+	envFrom := map[string]string{
+		"A":   "vault://secret/data/deleted#password",
+		"B":   "vault://secret/data/missing#password",
+		"C":   "vault://secret/data/app#missing",
+		"D":   "vault://secret/data/app?stage=x",
+		"E_*": "vault://kv/app#api_key",
+	}
+
+	_, err := sev.LoadEnvWith(envFrom, nil, sev.NewVaultProvider(nil))
+	assert.EqualError(err, "failed to get vault://kv/app#api_key: wildcard key cannot select a JSON key: 'api_key'\n"+
+		"failed to get vault://secret/data/deleted#password: secret has no data in 'secret/data/deleted': it may be deleted\n"+
+		"failed to get vault://secret/data/missing#password: GET secret/data/missing: 404\n"+
+		"failed to get vault://secret/data/app#missing: key could not be found in 'secret/data/app': 'missing'\n"+
+		"failed to get vault://secret/data/app?stage=x: unknown query parameter in 'secret/data/app?stage=x': 'stage'")
+
+	t.Setenv("VAULT_TOKEN", "s.wrong")
+	_, err = sev.LoadEnvWith(map[string]string{"A": "vault://kv/app"}, nil, sev.NewVaultProvider(nil))
+	assert.EqualError(err, "failed to get vault://kv/app: GET kv/app: 403: permission denied")
+
+	t.Setenv("VAULT_ADDR", "")
+	_, err = sev.LoadEnvWith(map[string]string{"A": "vault://kv/app"}, nil, sev.NewVaultProvider(nil))
+	assert.EqualError(err, "failed to get vault://kv/app: vault address is not set: set address in _sev.vault or VAULT_ADDR")
+}
+
+func Test_loadEnv_Vault_Timeout(t *testing.T) {
+	assert := assert.New(t)
+
+	done := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+
+	defer server.Close()
+	defer close(done)
+	defer sev.SetVaultTimeout(100 * time.Millisecond)()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "s.token")
+
+	_, err := sev.LoadEnvWith(map[string]string{"A": "vault://kv/app"}, nil, sev.NewVaultProvider(nil))
+	assert.ErrorContains(err, "failed to get vault://kv/app: Get ")
+	assert.ErrorContains(err, "Client.Timeout exceeded")
+}
+
+func Test_loadEnv_Vault_Canceled(t *testing.T) {
+	assert := assert.New(t)
+
+	server, calls := newVaultServer(t, "s.token")
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "s.token")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := sev.NewVaultProvider(nil).Resolve(ctx, &sev.Reference{Name: "A", URI: "vault://kv/app#api_key"})
+	assert.ErrorIs(err, context.Canceled)
+	assert.Empty(calls)
+}
+
+func Test_loadVaultSettings(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tomlFile, _ := os.CreateTemp("", "")
+	defer os.Remove(tomlFile.Name())
+	tomlFile.WriteString(`[prod]
+FOO = "vault://secret/data/app#password"
+[prod._sev]
+region = "ap-northeast-1"
+[prod._sev.vault]
+address = "https://vault.example.com:8200"
+namespace = "team-a"
+auth = "kubernetes"
+role = "app"
+`)
+	tomlFile.Sync()
+
+	settings, err := sev.LoadVaultSettings(tomlFile.Name(), "prod")
+	require.NoError(err)
+	assert.Equal(&sev.VaultSettings{
+		Address:   "https://vault.example.com:8200",
+		Namespace: "team-a",
+		Auth:      "kubernetes",
+		Role:      "app",
+	}, settings)
+
+	awsSettings, err := sev.LoadAWSSettings(tomlFile.Name(), "prod", "")
+	require.NoError(err)
+	assert.Equal(&sev.AWSSettings{Region: "ap-northeast-1"}, awsSettings)
+}
+
+func Test_loadVaultSettings_Err(t *testing.T) {
+	assert := assert.New(t)
+
+	tt := map[string]string{
+		"vault = \"https://vault.example.com\"": "vault in _sev must be a table",
+		"vault = { token = \"s.token\" }":       "unknown key in _sev.vault: token",
+		"vault = { address = 8200 }":            "value of vault.address in _sev must be a string",
+		"vault = { auth = \"ldap\" }":           "unknown auth method in _sev.vault: ldap",
+	}
+
+	for settings, expected := range tt {
+		tomlFile, _ := os.CreateTemp("", "")
+		defer os.Remove(tomlFile.Name())
+		tomlFile.WriteString("[abc]\nFOO = \"BAR\"\n[abc._sev]\n" + settings + "\n")
+		tomlFile.Sync()
+
+		_, err := sev.LoadVaultSettings(tomlFile.Name(), "abc")
+		assert.EqualError(err, expected)
+	}
+}